@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// byteCounter adds up the bytes of every request sent and response received
+// by the clients it wraps. Heads are counted as HTTP/1.1 would send them.
+type byteCounter struct {
+	sent     int64
+	received int64
+}
+
+// client returns a copy of c counting its traffic, so a pooled client can be
+// counted for a single read
+func (b *byteCounter) client(c *http.Client) *http.Client {
+	counted := *c
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	counted.Transport = &countingTransport{base: transport, counter: b}
+	return &counted
+}
+
+func (b *byteCounter) bytesSent() int64 {
+	return atomic.LoadInt64(&b.sent)
+}
+
+func (b *byteCounter) bytesReceived() int64 {
+	return atomic.LoadInt64(&b.received)
+}
+
+// countingTransport is called for every attempt and redirect
+type countingTransport struct {
+	base    http.RoundTripper
+	counter *byteCounter
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	head := len(req.Method) + len(" ") + len(req.URL.RequestURI()) + len(" HTTP/1.1\r\n") +
+		headerSize(http.Header{"Host": {host}}) + headerSize(req.Header) + len("\r\n")
+	atomic.AddInt64(&t.counter.sent, int64(head))
+
+	if req.Body != nil && req.Body != http.NoBody {
+		// the transport owns req, send a copy reading through the counter
+		counted := *req
+		counted.Body = &countingBody{ReadCloser: req.Body, n: &t.counter.sent}
+		req = &counted
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	head = len(resp.Proto) + len(" ") + len(resp.Status) + len("\r\n") + headerSize(resp.Header) + len("\r\n")
+	atomic.AddInt64(&t.counter.received, int64(head))
+	resp.Body = &countingBody{ReadCloser: resp.Body, n: &t.counter.received}
+	return resp, nil
+}
+
+// headerSize is the size of h as "Name: value\r\n" lines
+func headerSize(h http.Header) int {
+	size := 0
+	for name, values := range h {
+		for _, value := range values {
+			size += len(name) + len(": ") + len(value) + len("\r\n")
+		}
+	}
+	return size
+}
+
+// countingBody adds the bytes read from a body to n
+type countingBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestByteCounter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/echo", http.StatusPermanentRedirect)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header()["Date"] = nil
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	counter := &byteCounter{}
+	client := counter.client(server.Client())
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/redirect", strings.NewReader("hello"))
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	head := func(path, extra string) string {
+		return "POST " + path + " HTTP/1.1\r\nHost: " + host + "\r\nContent-Type: text/plain\r\n" + extra + "\r\n"
+	}
+	// the redirected request adds a Referer
+	wantSent := len(head("/redirect", "")) + len("hello") + len(head("/echo", "Referer: "+server.URL+"/redirect\r\n")) + len("hello")
+	if got := counter.bytesSent(); got != int64(wantSent) {
+		t.Errorf("bytesSent() = %d; want %d", got, wantSent)
+	}
+
+	if counter.bytesReceived() <= int64(len("HTTP/1.1 200 OK\r\n\r\nhello")) {
+		t.Errorf("bytesReceived() = %d; want the heads of both responses and the body", counter.bytesReceived())
+	}
+
+	// the pooled client is left as it was
+	if _, ok := server.Client().Transport.(*countingTransport); ok {
+		t.Error("client() should not change the client it copies")
+	}
+}
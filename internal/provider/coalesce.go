@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// requestCoalescer shares one network call between identical requests of
+// concurrent reads of one provider instance
+type requestCoalescer struct {
+	group singleflight.Group
+}
+
+// coalescedResponse is a response with its body read, so that every read
+// sharing it gets its own copy
+type coalescedResponse struct {
+	resp *http.Response
+	body []byte
+}
+
+// do sends req with client, unless an identical request with the same key is
+// in flight in which case its response is shared. A nil coalescer always sends.
+func (c *requestCoalescer) do(client *http.Client, req *http.Request, key string) (*http.Response, error) {
+	if c == nil || key == "" {
+		return client.Do(req)
+	}
+
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &coalescedResponse{resp: resp, body: body}, nil
+	})
+	var result singleflight.Result
+	select {
+	case result = <-ch:
+	case <-req.Context().Done():
+		// only stops waiting, the call is bound to the context of the read that made it
+		return nil, req.Context().Err()
+	}
+	if result.Err != nil {
+		return nil, result.Err
+	}
+
+	shared := result.Val.(*coalescedResponse)
+	resp := *shared.resp
+	resp.Header = shared.resp.Header.Clone()
+	resp.Trailer = shared.resp.Trailer.Clone()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(shared.body))
+	return &resp, nil
+}
+
+// coalesceKey identifies a request by its client settings, method, URL,
+// headers and body. A body that cannot be read again, such as one streamed
+// from request_body_url, has no key and is never coalesced.
+func coalesceKey(req *http.Request, client clientPoolKey) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%+v\n%s %s\n", client, req.Method, req.URL.String())
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s: %s\n", name, strings.Join(req.Header[name], "\x00"))
+	}
+	fmt.Fprintf(h, "Host: %s\n\n", req.Host)
+
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return "", nil
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		if _, err := io.Copy(h, body); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestCoalescerDo(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Header().Set("X-Version", "1.0.0")
+		w.Write([]byte("1.0.0"))
+	}))
+	defer server.Close()
+
+	coalescer := &requestCoalescer{}
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			resp, err := coalescer.do(http.DefaultClient, req, "key")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			bodies[i] = resp.Header.Get("X-Version") + " " + string(body)
+		}(i)
+	}
+	// let every read join the call in flight
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if hits != 1 {
+		t.Errorf("server got %d requests, want 1", hits)
+	}
+	for i, body := range bodies {
+		if body != "1.0.0 1.0.0" {
+			t.Errorf("read %d got %q, want %q", i, body, "1.0.0 1.0.0")
+		}
+	}
+
+	// nothing in flight, a new call is made
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := coalescer.do(http.DefaultClient, req, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hits != 2 {
+		t.Errorf("server got %d requests, want 2", hits)
+	}
+}
+
+func TestCoalesceKey(t *testing.T) {
+	newRequest := func(method, body string, header http.Header) *http.Request {
+		var req *http.Request
+		if body == "" {
+			req, _ = http.NewRequest(method, "https://example.com/get", nil)
+		} else {
+			req, _ = http.NewRequest(method, "https://example.com/get", strings.NewReader(body))
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		return req
+	}
+	key := func(req *http.Request, client clientPoolKey) string {
+		k, err := coalesceKey(req, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	base := key(newRequest(http.MethodPost, "a=1", http.Header{"Accept": {"text/plain"}}), clientPoolKey{})
+	if base == "" {
+		t.Fatal("a body that can be read again should have a key")
+	}
+	if key(newRequest(http.MethodPost, "a=1", http.Header{"Accept": {"text/plain"}}), clientPoolKey{}) != base {
+		t.Error("identical requests should have the same key")
+	}
+	for name, k := range map[string]string{
+		"method": key(newRequest(http.MethodPut, "a=1", http.Header{"Accept": {"text/plain"}}), clientPoolKey{}),
+		"body":   key(newRequest(http.MethodPost, "a=2", http.Header{"Accept": {"text/plain"}}), clientPoolKey{}),
+		"header": key(newRequest(http.MethodPost, "a=1", http.Header{"Accept": {"application/json"}}), clientPoolKey{}),
+		"client": key(newRequest(http.MethodPost, "a=1", http.Header{"Accept": {"text/plain"}}), clientPoolKey{timeout: time.Second}),
+	} {
+		if k == base {
+			t.Errorf("a different %s should have a different key", name)
+		}
+	}
+
+	streamed := newRequest(http.MethodPost, "a=1", nil)
+	streamed.GetBody = nil
+	if key(streamed, clientPoolKey{}) != "" {
+		t.Error("a body that cannot be read again should have no key")
+	}
+}
@@ -1,23 +1,69 @@
 package provider
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	neturl "net/url"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"github.com/andybalholm/brotli"
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/klauspost/compress/zstd"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
 )
 
+const redacted = "<redacted>"
+
+// defaultMaxResponseHeaderBytes is well above what any sane server sends
+// but lower than the 10MB the transport otherwise allows
+const defaultMaxResponseHeaderBytes = 1 << 20
+
+// defaultMaxRedirects is the limit of the default redirect policy
+const defaultMaxRedirects = 10
+
+// sensitiveHeaders are never rendered in plaintext
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"X-Api-Key",
+}
+
 func validateVerb(val interface{}, key string) (warns []string, errs []error) {
 	if v, ok := val.(string); ok {
 		switch v {
@@ -27,10 +73,11 @@ func validateVerb(val interface{}, key string) (warns []string, errs []error) {
 			http.MethodHead,
 			http.MethodPatch,
 			http.MethodDelete,
-			http.MethodPut:
+			http.MethodPut,
+			http.MethodOptions:
 			break
 		default:
-			errs = append(errs, fmt.Errorf("%s must be GET|POST|HEAD|DELETE|PATCH|PUT, got: %s", key, v))
+			errs = append(errs, fmt.Errorf("%s must be GET|POST|HEAD|DELETE|PATCH|PUT|OPTIONS, got: %s", key, v))
 		}
 	} else {
 		errs = append(errs, fmt.Errorf("error parsing method"))
@@ -38,26 +85,119 @@ func validateVerb(val interface{}, key string) (warns []string, errs []error) {
 	return
 }
 
+func validateProtocol(val interface{}, key string) (warns []string, errs []error) {
+	if v, ok := val.(string); ok {
+		switch v {
+		case "HTTP/1.0", "HTTP/1.1", "HTTP/2.0":
+			break
+		default:
+			errs = append(errs, fmt.Errorf("%s must be HTTP/1.0|HTTP/1.1|HTTP/2.0, got: %s", key, v))
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("error parsing %s", key))
+	}
+	return
+}
+
+func validateHTTPDate(val interface{}, key string) (warns []string, errs []error) {
+	if v, ok := val.(string); ok {
+		if _, err := http.ParseTime(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s must be an HTTP date (eg %s), got: %s", key, http.TimeFormat, v))
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("error parsing %s", key))
+	}
+	return
+}
+
+func validateRegexCaptures(val interface{}, key string) (warns []string, errs []error) {
+	if v, ok := val.(string); ok {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s is not a valid regular expression: %s", key, err))
+			return
+		}
+		named := false
+		for _, name := range re.SubexpNames() {
+			if name != "" {
+				named = true
+			}
+		}
+		if !named {
+			errs = append(errs, fmt.Errorf("%s must have at least one named group, eg (?P<name>...)", key))
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("error parsing %s", key))
+	}
+	return
+}
+
+func validateRegex(val interface{}, key string) (warns []string, errs []error) {
+	if v, ok := val.(string); ok {
+		if _, err := regexp.Compile(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s is not a valid regular expression: %s", key, err))
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("error parsing %s", key))
+	}
+	return
+}
+
+// regexCaptures returns the named groups of the first match of expr in body,
+// empty when it does not match
+func regexCaptures(expr string, body []byte) map[string]string {
+	re := regexp.MustCompile(expr)
+	captures := map[string]string{}
+	match := re.FindSubmatch(body)
+	if match == nil {
+		return captures
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			captures[name] = string(match[i])
+		}
+	}
+	return captures
+}
+
 func dataSource() *schema.Resource {
 	return &schema.Resource{
 		ReadContext: dataSourceRead,
 
 		Schema: map[string]*schema.Schema{
 			"url": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type: schema.TypeString,
+				// only required while enabled, see dataSourceRead
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"path_params": {
+				Description: "A map of values substituted, URL path escaped, for `{name}` tokens in `url`.",
+				Type:        schema.TypeMap,
+				Optional:    true,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
 			},
 
+			"enabled": {
+				Description: "Set to false to skip the request entirely.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+			},
+
 			"method": {
 				Type:     schema.TypeString,
 				Optional: true,
+				// no Default so an explicit GET can be told apart from an unset method
+				Computed: true,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
-				Default:      http.MethodGet,
 				ValidateFunc: validateVerb,
 			},
 
@@ -69,6 +209,64 @@ func dataSource() *schema.Resource {
 				},
 			},
 
+			"extra_headers": {
+				Description: "Request headers added after `request_headers`, which may repeat a name.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"value": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+					},
+				},
+			},
+
+			"sensitive_request_body": {
+				Description: "Same as `request_body` but hidden from plan output and stored as a SHA-256 hash in state.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				StateFunc:   hashSensitiveValue,
+				ConflictsWith: []string{
+					"request_body",
+				},
+			},
+
+			"proxy_connect_headers": {
+				Description: "A map of headers to send to the proxy with the `CONNECT` request for `https` targets.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"proxy_url": {
+				Description: "URL of the proxy to use instead of the one in `HTTP_PROXY`/`HTTPS_PROXY`.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+
+			"no_proxy_hosts": {
+				Description: "Hosts, domains (`.example.com`), IPs or CIDRs reached directly rather than through the proxy, in addition to `NO_PROXY`.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"interface": {
+				Description: "Name of the network interface (eg `eth1`) whose address connections are made from.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+
 			"request_body": {
 				Type:     schema.TypeString,
 				Computed: false,
@@ -78,6 +276,144 @@ func dataSource() *schema.Resource {
 				},
 			},
 
+			"request_body_file": {
+				Description: "Path of a file streamed as the request body, eg `/dev/stdin`.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ConflictsWith: []string{
+					"request_body",
+					"sensitive_request_body",
+					"request_body_base64_file",
+				},
+			},
+
+			"request_body_base64_file": {
+				Description: "Path of a file holding base64, decoded as it is streamed as the request body.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ConflictsWith: []string{
+					"request_body",
+					"sensitive_request_body",
+				},
+			},
+
+			"request_body_url": {
+				Description: "URL whose response body is streamed as the request body.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ConflictsWith: []string{
+					"request_body",
+					"sensitive_request_body",
+					"request_body_file",
+					"request_body_base64_file",
+					"json_body",
+				},
+			},
+
+			"request_body_sha256_trailer": {
+				Description: "Name of an HTTP trailer carrying the hex SHA-256 of the request body, computed while it is streamed.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+
+			"json_body": {
+				Description: "A map sent as a JSON object request body, with `Content-Type: application/json`.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				ConflictsWith: []string{
+					"request_body",
+					"sensitive_request_body",
+					"request_body_file",
+					"request_body_base64_file",
+				},
+			},
+
+			"no_default_content_type": {
+				Description: "Never add the `Content-Type` implied by the request body attributes, only send one set in `request_headers`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+
+			"if_modified_since": {
+				Description:  "HTTP date sent in the `If-Modified-Since` request header.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateHTTPDate,
+			},
+
+			"idempotency_key": {
+				Description: "Value sent in the `Idempotency-Key` request header. " +
+					"If not set, a random UUID is generated for `POST` requests.",
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+
+			"request_nonce": {
+				Description: "Add a timestamp and a unique nonce header to the request, optionally signed with HMAC-SHA256.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"timestamp_header": {
+							Description: "Header set to the Unix time of the request in seconds.",
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "X-Timestamp",
+						},
+						"nonce_header": {
+							Description: "Header set to a random UUID.",
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "X-Nonce",
+						},
+						"hmac_key": {
+							Description: "Key to sign the timestamp, nonce, method, request URI and body with.",
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+						},
+						"kms_signer": {
+							Description: "Sign with an HMAC key held in a cloud KMS instead of `hmac_key`.",
+							Type:        schema.TypeList,
+							Optional:    true,
+							MaxItems:    1,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"provider": {
+										Description:  "KMS holding the key, `gcp` or `aws`.",
+										Type:         schema.TypeString,
+										Required:     true,
+										ValidateFunc: validateKMSProvider,
+									},
+									"key": {
+										Description: "GCP crypto key version resource name, or AWS key ID, ARN or alias.",
+										Type:        schema.TypeString,
+										Required:    true,
+									},
+									"endpoint": {
+										Description: "KMS API endpoint, eg a private endpoint, instead of the public one.",
+										Type:        schema.TypeString,
+										Optional:    true,
+									},
+								},
+							},
+						},
+						"signature_header": {
+							Description: "Header set to the hex encoded signature when `hmac_key` or `kms_signer` is set.",
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "X-Signature",
+						},
+					},
+				},
+			},
+
 			"body": {
 				Description: "The raw body of the HTTP response. " +
 					"**NOTE**: This is deprecated, use `response_body` instead.",
@@ -97,6 +433,104 @@ func dataSource() *schema.Resource {
 					Type: schema.TypeString,
 				},
 			},
+			"response_charset": {
+				Description: "Charset of the response body, overriding the one in the `Content-Type` response header.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"split_response_lines": {
+				Description: "Set `response_lines` to the response body split into lines, for text content types.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"response_lines": {
+				Description: "With `split_response_lines`, the response body split into lines, for text content types.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"body_file": {
+				Description: "Path of the file holding the response body when it is larger than the provider `max_inline_body_bytes`, the same for the same URL and body.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"response_body_base64": {
+				Description: "The response body (before any charset decoding), base64 encoded, with `include_response_body_base64` or when the body is not valid UTF-8.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"include_response_body_base64": {
+				Description: "Set `response_body_base64` for text bodies too, which are otherwise only stored in `response_body`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"unwrap_json_key": {
+				Description: "Top level key of a JSON envelope (eg `data`) whose content is stored as the body instead of the whole response.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"response_body_hex_decode": {
+				Description: "Hex decode the response body into `response_body_base64`, for binary data a server sends as hex text.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"accept_encoding": {
+				Description: "Value of the `Accept-Encoding` request header. Anything but `gzip` disables transparent decompression.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"disable_auto_decompress": {
+				Description: "Do not request or transparently decode gzip responses; the body is kept as sent on the wire.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"spnego": {
+				Description: "Authenticate with Kerberos by sending an `Authorization: Negotiate` (SPNEGO) header.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"keytab_file": {
+							Description: "Path to a keytab for `username`; conflicts with `ccache_file`.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"username": {
+							Description: "Principal name to log in as with `keytab_file`.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"realm": {
+							Description: "Realm of `username`.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"ccache_file": {
+							Description: "Path to a credentials cache (eg from `kinit`); conflicts with `keytab_file`.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"krb5_conf": {
+							Description: "Path to the Kerberos configuration.",
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     defaultKrb5Conf,
+						},
+						"spn": {
+							Description: "Service principal name of the target, defaults to `HTTP/<url hostname>`.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+					},
+				},
+			},
 			"sni": {
 				Type:     schema.TypeString,
 				Optional: true,
@@ -110,7 +544,172 @@ func dataSource() *schema.Resource {
 				Elem: &schema.Schema{
 					Type: schema.TypeBool,
 				},
-				Default: false,
+				// no Default, if unset the provider level setting applies
+			},
+			"key_log_file": {
+				Description: "Append the TLS session keys to this file, in the format Wireshark reads, for debugging. Defaults to `SSLKEYLOGFILE`.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("SSLKEYLOGFILE", ""),
+			},
+			"disable_session_tickets": {
+				Description: "Disable TLS session resumption so every connection performs a full handshake.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"require_protocol": {
+				Description:  "Fail unless the response is received over this protocol (`HTTP/1.0`, `HTTP/1.1` or `HTTP/2.0`).",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateProtocol,
+			},
+			"alpn_protocols": {
+				Description: "List of ALPN protocols to advertise during the TLS handshake (eg `h2`, `http/1.1`). Only valid for `https` URLs.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"tls_client_hello": {
+				Description:   "Send the TLS ClientHello of a browser or client, one of `chrome`, `firefox`, `safari`, `edge`, `ios` or `android`, instead of the Go one. Its ALPN extension is changed to only offer `http/1.1`, so the JA4 and HTTP/2 fingerprints differ from the client's.",
+				Type:          schema.TypeString,
+				Optional:      true,
+				ValidateFunc:  validateClientHello,
+				ConflictsWith: []string{"alpn_protocols"},
+			},
+			"dry_run": {
+				Description: "Build the request and expose it in `rendered_request` without sending it.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"rendered_request": {
+				Description: "JSON rendering of the request (`method`, `url`, `headers`, `body`) built with `dry_run`, with secrets redacted.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"coalesce_requests": {
+				Description: "Share one network call with the identical requests of concurrent reads that also set it.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"bypass_rate_limit": {
+				Description: "Send the requests without waiting for the provider `requests_per_second` limit, eg for health checks.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"max_retries": {
+				Description: "Number of times to retry the request after a connection error or a 429, 502, 503 or 504 response.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     0,
+			},
+			"retry_wait_ms": {
+				Description: "Wait before the first retry in ms, doubled for each following one. A `Retry-After` response header takes precedence.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     1000,
+			},
+			"max_retry_wait_ms": {
+				Description: "Longest wait between two retries in ms, the doubling of `retry_wait_ms` stops there.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     30000,
+			},
+			"attempts_made": {
+				Description: "Number of times the request was sent, 1 plus the retries.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"request_bytes_sent": {
+				Description: "Bytes of the request heads and bodies sent, over every attempt, redirect and page.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"response_bytes_received": {
+				Description: "Bytes of the response heads and bodies received before decompression, over every attempt, redirect and page.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"refresh_auth_on_401": {
+				Description: "On a 401 response, get a new `bearer_token_vault` token or `spnego` ticket and send the request once more.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"retry_body_regex": {
+				Description:  "Also retry a response whose body matches this regular expression, eg `\"status\":\\s*\"pending\"`.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateRegex,
+			},
+			"write_timeout_ms": {
+				Description: "Maximum time in ms to upload the request body.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+			},
+			"max_download_time_ms": {
+				Description: "Maximum time in ms to download the response body, counted from when the response headers are received.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+			},
+			"read_limit_bytes": {
+				Description: "Only read the first N bytes of the response body, the rest is discarded.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+			},
+			"body_truncated": {
+				Description: "Whether the response body was longer than `read_limit_bytes`.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"require_non_empty_body": {
+				Description: "Fail if the response body is empty.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"restrict_redirect_host": {
+				Description: "Fail instead of following a redirect to a host other than the one in `url`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"redirect_strip_headers": {
+				Description: "More request headers not sent to a redirect or page on another host than the one in `url`, besides the credentials and `request_nonce` headers.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"https_only_redirects": {
+				Description: "Fail instead of following a redirect to a URL that is not `https`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"resend_body_on_redirect": {
+				Description: "Send the request body again when following a 307 or 308 redirect, else fail on such a redirect.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+			},
+			"accept_redirect_without_location": {
+				Description: "Return a 301, 302, 303, 307 or 308 response without a `Location` header as the final response instead of failing.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"max_redirects": {
+				Description: "Number of redirects to follow before failing, `0` fails on the first one.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     defaultMaxRedirects,
 			},
 			"request_timeout_ms": {
 				Type:     schema.TypeInt,
@@ -119,6 +718,193 @@ func dataSource() *schema.Resource {
 					Type: schema.TypeBool,
 				},
 			},
+			"max_response_header_bytes": {
+				Description: "Maximum size in bytes of the response headers; larger responses are rejected.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     defaultMaxResponseHeaderBytes,
+			},
+			"success_when": {
+				Description:  "A CEL expression over `status`, `headers` and `body` the response must satisfy, instead of a 2xx status.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateSuccessWhen,
+			},
+			"error_message_jsonpath": {
+				Description:  "JSONPath (eg `$.error.message`) of the message in a JSON error response to report instead of the whole body.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateJSONPath,
+			},
+			"fail_on_error_status": {
+				Description: "Fail on a non 2xx status when `success_when` is not set, else only warn and store the response.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+			},
+			"expected_response_headers": {
+				Description: "A map of response headers and the values they must have.",
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"response_json_schema": {
+				Description: "A JSON Schema document the response body must validate against.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"validate_against_openapi": {
+				Description: "Validate the response status, headers and body against an operation of an OpenAPI 3 document.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"spec_file": {
+							Description: "Path of the OpenAPI 3 document, JSON or YAML.",
+							Type:        schema.TypeString,
+							Required:    true,
+						},
+						"operation_id": {
+							Description: "`operationId` of the operation whose responses the response must match.",
+							Type:        schema.TypeString,
+							Required:    true,
+						},
+					},
+				},
+			},
+			"parse_prometheus": {
+				Description: "Parse the response body in the Prometheus text exposition format; see `metric_name`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"metric_name": {
+				Description: "Name of the metric whose samples are extracted into `metric_values` when `parse_prometheus` is set.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"metric_values": {
+				Description: "Samples of `metric_name`, each with its `labels` and `value`.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"labels": {
+							Type:     schema.TypeMap,
+							Computed: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"value": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+			"jq": {
+				Description:  "A jq expression applied to the JSON response body, producing `transformed_body`.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateJQ,
+			},
+			"transformed_body": {
+				Description: "The results of `jq`, JSON encoded one per line.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"parsed_body": {
+				Description: "The response body parsed according to its `Content-Type` (JSON, XML or form encoded), JSON encoded. The raw body for other types, empty for a `body_file`.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"paginate": {
+				Description: "Follow the next page links of the response, accumulating the body of every page in `pages`.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"next_header": {
+							Description: "Response header with the URL of the next page. For `Link`, the `rel=\"next\"` link.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"next_jsonpath": {
+							Description:  "JSONPath of the URL of the next page in the JSON response body, eg `$.links.next`.",
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateJSONPath,
+						},
+						"max_pages": {
+							Description: "Maximum number of pages to read, including the first.",
+							Type:        schema.TypeInt,
+							Optional:    true,
+							Default:     defaultMaxPages,
+						},
+					},
+				},
+			},
+			"pages": {
+				Description: "With `paginate`, the body of every page, starting with `response_body`.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"response_body_regex": {
+				Description:  "A regular expression matched against the response body, its named groups producing `response_body_regex_captures`.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateRegexCaptures,
+			},
+			"response_body_regex_captures": {
+				Description: "The named groups of the first match of `response_body_regex`, keyed by name.",
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"ndjson": {
+				Description: "Read the response as a newline delimited JSON stream into `ndjson_objects`, until it ends or the request times out.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"ndjson_objects": {
+				Description: "Each JSON value of an `ndjson` response, in order.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"response_parts": {
+				Description: "The parts of a `multipart/*` response, each with its `headers` and `body`.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"headers": {
+							Type:     schema.TypeMap,
+							Computed: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"body": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
 			"response_headers": {
 				Type:     schema.TypeMap,
 				Computed: true,
@@ -126,214 +912,2631 @@ func dataSource() *schema.Resource {
 					Type: schema.TypeString,
 				},
 			},
-			"status_code": {
-				Type:     schema.TypeInt,
-				Computed: true,
-				Elem: &schema.Schema{
-					Type: schema.TypeInt,
+			"response_cookies_detail": {
+				Description: "The cookies of the `Set-Cookie` response headers, each with its `name`, `value`, `domain`, `path`, `expires`, `secure`, `http_only` and `same_site` attributes.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"value": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"domain": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"path": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"expires": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"secure": {
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+						"http_only": {
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+						"same_site": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
 				},
 			},
-			"ca": {
-				Type:     schema.TypeString,
-				Required: false,
-				Optional: true,
+			"effective_request_headers": {
+				Description: "The request headers as sent on the wire, after authentication headers were added, with secrets redacted.",
+				Type:        schema.TypeMap,
+				Computed:    true,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
 			},
-			"client_crt": {
-				Type:     schema.TypeString,
-				Required: false,
-				Optional: true,
+			"raw_response_headers": {
+				Description: "The status line and headers of the response exactly as received, for plain HTTP/1.x only.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"response_trailers": {
+				Description: "A map of the HTTP trailers sent after the response body.",
+				Type:        schema.TypeMap,
+				Computed:    true,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
 			},
-			"client_key": {
-				Type:      schema.TypeString,
-				Required:  false,
-				Optional:  true,
-				Sensitive: true,
+			"status_code": {
+				Type:     schema.TypeInt,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeInt,
+				},
+			},
+			"allowed_methods": {
+				Description: "The methods listed in the `Allow` response header of an `OPTIONS` request.",
+				Type:        schema.TypeList,
+				Computed:    true,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
 			},
-		},
-	}
-}
+			"not_modified": {
+				Description: "True if the server responded `304 Not Modified` to a conditional request.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"last_modified": {
+				Description: "The `Last-Modified` header of the response, if any.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"server_time": {
+				Description: "The `Date` header of the response in RFC 3339 format, if any.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"clock_skew_ms": {
+				Description: "The `Date` header of the response minus the local time it was received at, in milliseconds. 0 without a `Date` header.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"remote_addr": {
+				Description: "The remote address (`ip:port`) of the connection that served the request.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"used_proxy": {
+				Description: "Whether the request was sent through a proxy, from `proxy_url` or the environment, rather than directly.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"proxy_addr": {
+				Description: "The address (`host:port`) of the proxy the request was sent through, empty when direct.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"connection_reused": {
+				Description: "True if the request was sent over a previously established (pooled) connection.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"resolved_ip": {
+				Description: "The IP address the target hostname resolved to when the request was made.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"local_addr": {
+				Description: "The local address (`ip:port`) of the connection that served the request.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"dns_ms": {
+				Description: "Time spent resolving the hostname, in milliseconds.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"connect_ms": {
+				Description: "Time spent establishing the TCP connection, in milliseconds.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"tls_ms": {
+				Description: "Time spent in the TLS handshake, in milliseconds.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"ttfb_ms": {
+				Description: "Time from sending the request until the first response byte, in milliseconds.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"tls_peer_certificates_pem": {
+				Description: "The certificate chain presented by the server, leaf first, each PEM encoded.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"client_cert_sent": {
+				Description: "Whether the server requested the client certificate and it was presented during the handshake.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"ca": {
+				Type:     schema.TypeString,
+				Required: false,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"ca_base64": {
+				Description:   "Certificate Authority (PEM) for the target server, base64 encoded.",
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"ca"},
+			},
+			"min_cert_validity_days": {
+				Description: "Warn if the server certificate expires within this many days.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+			},
+			"min_cert_validity_error": {
+				Description: "Fail the request instead of warning when `min_cert_validity_days` is not met.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"allowed_server_fingerprints": {
+				Description: "SHA-256 fingerprints (hex) of server certificates to accept without verifying their chain.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"expected_cert_cn": {
+				Description: "Fail unless the subject common name of the server certificate is this value.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"expected_cert_san": {
+				Description: "Fail unless this value is one of the DNS, IP, URI or email subject alternative names of the server certificate.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"pinned_issuer": {
+				Description: "Issuer certificate (PEM), eg a private intermediate, the server certificate must chain to, on top of the usual chain verification.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"ca_dir": {
+				Description: "Directory of `*.pem`/`*.crt` Certificate Authority files for the target server.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"client_crt": {
+				Type:     schema.TypeString,
+				Required: false,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"client_crt_base64": {
+				Description:   "Client certificate (PEM), base64 encoded.",
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"client_crt", "client_crt_file"},
+			},
+			"client_key_base64": {
+				Description:   "Client certificate private key (PEM), base64 encoded.",
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{"client_key", "client_key_file"},
+			},
+			"client_crt_file": {
+				Description: "Path of the client certificate (PEM), read on every request.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ConflictsWith: []string{
+					"client_crt",
+				},
+				RequiredWith: []string{
+					"client_key_file",
+				},
+			},
+			"client_key_file": {
+				Description: "Path of the client certificate private key (PEM), read on every request.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				ConflictsWith: []string{
+					"client_key",
+				},
+				RequiredWith: []string{
+					"client_crt_file",
+				},
+			},
+			"client_key": {
+				Type:      schema.TypeString,
+				Required:  false,
+				Optional:  true,
+				Sensitive: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"client_key_password": {
+				Description: "Password of an encrypted PKCS#8 (`ENCRYPTED PRIVATE KEY`) client certificate private key.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+			},
+			"client_key_vault": vaultSecretSchema(
+				"Read the private key of `client_crt` from a Vault KV secret on every request.",
+				"client_key", "client_key_file", "client_key_base64",
+			),
+			"client_key_pkcs11": {
+				Description:   "Use the private key of `client_crt` held in a PKCS#11 token, such as an HSM.",
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				ConflictsWith: []string{"client_key", "client_key_file", "client_key_base64", "client_key_vault"},
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"module": {
+							Description:  "Path of the PKCS#11 module (shared library).",
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validatePKCS11Module,
+						},
+						"token_label": {
+							Description: "Label of the token holding the key, instead of `slot_number`.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"slot_number": {
+							Description: "Slot of the token holding the key, instead of `token_label`.",
+							Type:        schema.TypeInt,
+							Optional:    true,
+							Default:     -1,
+						},
+						"pin": {
+							Description: "User PIN of the token.",
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+						},
+						"key_label": {
+							Description: "Label (`CKA_LABEL`) of the key.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"key_id": {
+							Description: "Hex encoded ID (`CKA_ID`) of the key.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+					},
+				},
+			},
+			"bearer_token_vault": vaultSecretSchema(
+				"Read a token from a Vault KV secret on every request and send it in an `Authorization: Bearer` header.",
+			),
+		},
+	}
+}
+
+func dataSourceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	url := d.Get("url").(string)
+	headers := d.Get("request_headers").(map[string]interface{})
+
+	if !d.Get("enabled").(bool) {
+		return dataSourceDisabled(d, url)
+	}
+
+	if url == "" {
+		return append(diags, diag.Errorf("url must be set when enabled")...)
+	}
+
+	if d.Get("max_response_header_bytes").(int) <= 0 {
+		return append(diags, diag.Errorf("max_response_header_bytes must be greater than 0")...)
+	}
+
+	url, err := expandPathParams(url, d.Get("path_params").(map[string]interface{}))
+	if err != nil {
+		return append(diags, diag.Errorf("Error expanding path_params: %s", err)...)
+	}
+
+	var skip_verify bool
+	if config, ok := meta.(*providerConfig); ok {
+		skip_verify = config.insecureSkipVerify
+	}
+	if isSetInConfig(d, "insecure_skip_verify") {
+		skip_verify = d.Get("insecure_skip_verify").(bool)
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: skip_verify,
+	}
+	// the transport is shared with every read that has the same key
+	key := transportKey{insecureSkipVerify: skip_verify}
+
+	if keyLogFile := d.Get("key_log_file").(string); keyLogFile != "" {
+		w, err := keyLogWriter(keyLogFile)
+		if err != nil {
+			return append(diags, diag.Errorf("Error opening key_log_file: %s", err)...)
+		}
+		tlsConfig.KeyLogWriter = w
+		key.keyLogFile = keyLogFile
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "TLS key logging is enabled",
+			Detail:   fmt.Sprintf("The TLS session keys are written to %s, anyone reading it can decrypt the traffic.", keyLogFile),
+		})
+	}
+
+	if d.Get("disable_session_tickets").(bool) {
+		tlsConfig.SessionTicketsDisabled = true
+		// a nil ClientSessionCache also disables resumption of TLS 1.3 sessions
+		tlsConfig.ClientSessionCache = nil
+		key.disableSessionTickets = true
+	} else {
+		// without a cache no session is ever resumed; kept by the pooled transport
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	sni, ok := d.GetOk("sni")
+	if ok {
+		tlsConfig.ServerName = sni.(string)
+		key.serverName = sni.(string)
+	}
+
+	rootCAs := sha256.New()
+	castr, ok, err := getPEM(d, "ca")
+	if err != nil {
+		return append(diags, diag.Errorf("Error decoding ca_base64: %s", err)...)
+	}
+	if ok {
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM([]byte(castr))
+		tlsConfig.RootCAs = caCertPool
+		rootCAs.Write([]byte(castr))
+	}
+
+	caDir, ok := d.GetOk("ca_dir")
+	if ok {
+		if tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+		}
+		if err := appendCertsFromDir(tlsConfig.RootCAs, caDir.(string), rootCAs); err != nil {
+			return append(diags, diag.Errorf("Error loading ca_dir: %s", err)...)
+		}
+	}
+	if tlsConfig.RootCAs != nil {
+		key.rootCAs = hex.EncodeToString(rootCAs.Sum(nil))
+	}
+
+	minValidityDays := d.Get("min_cert_validity_days").(int)
+	if minValidityDays > 0 && d.Get("min_cert_validity_error").(bool) {
+		key.minValidityDays = minValidityDays
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return nil
+			}
+			return checkCertValidity(cs.PeerCertificates[0], minValidityDays)
+		}
+	}
+
+	if fps, ok := d.GetOk("allowed_server_fingerprints"); ok {
+		allowed := map[string]bool{}
+		for _, fp := range fps.([]interface{}) {
+			normalized := normalizeFingerprint(fp.(string))
+			if b, err := hex.DecodeString(normalized); err != nil || len(b) != sha256.Size {
+				return append(diags, diag.Errorf("allowed_server_fingerprints must be SHA-256 hex digests, got %q", fp)...)
+			}
+			allowed[normalized] = true
+		}
+		var sorted []string
+		for fp := range allowed {
+			sorted = append(sorted, fp)
+		}
+		sort.Strings(sorted)
+		key.serverFingerprints = strings.Join(sorted, ",")
+		// the pinned leaf replaces chain verification, VerifyConnection also runs on resumed sessions
+		tlsConfig.InsecureSkipVerify = true
+		verify := tlsConfig.VerifyConnection
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("no server certificate to match allowed_server_fingerprints")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if !allowed[hex.EncodeToString(sum[:])] {
+				return fmt.Errorf("server certificate fingerprint %s is not in allowed_server_fingerprints", hex.EncodeToString(sum[:]))
+			}
+			if verify != nil {
+				return verify(cs)
+			}
+			return nil
+		}
+	}
+
+	expectedCN := d.Get("expected_cert_cn").(string)
+	expectedSAN := d.Get("expected_cert_san").(string)
+	if expectedCN != "" || expectedSAN != "" {
+		key.expectedCertCN, key.expectedCertSAN = expectedCN, expectedSAN
+		// checked on top of, not instead of, chain and hostname verification
+		verify := tlsConfig.VerifyConnection
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("no server certificate to match expected_cert_cn or expected_cert_san")
+			}
+			if err := checkCertIdentity(cs.PeerCertificates[0], expectedCN, expectedSAN); err != nil {
+				return err
+			}
+			if verify != nil {
+				return verify(cs)
+			}
+			return nil
+		}
+	}
+
+	if pinned, ok := d.GetOk("pinned_issuer"); ok {
+		issuer, err := parseCertificatePEM(pinned.(string))
+		if err != nil {
+			return append(diags, diag.Errorf("Error parsing pinned_issuer: %s", err)...)
+		}
+		sum := sha256.Sum256(issuer.Raw)
+		key.pinnedIssuer = hex.EncodeToString(sum[:])
+		// a chain to any root of the pool is not enough, it must go through issuer
+		verify := tlsConfig.VerifyConnection
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if err := checkChainsToIssuer(cs.PeerCertificates, issuer); err != nil {
+				return err
+			}
+			if verify != nil {
+				return verify(cs)
+			}
+			return nil
+		}
+	}
+
+	requireProtocol := d.Get("require_protocol").(string)
+	// HTTP/2 is otherwise never attempted with a custom TLS configuration
+	forceHTTP2 := requireProtocol == "HTTP/2.0"
+	alpn, ok := d.GetOk("alpn_protocols")
+	if ok {
+		if !strings.HasPrefix(strings.ToLower(url), "https://") {
+			return append(diags, diag.Errorf("alpn_protocols can only be used with https URLs")...)
+		}
+		for _, p := range alpn.([]interface{}) {
+			proto := p.(string)
+			if proto == "h2" {
+				forceHTTP2 = true
+			}
+			tlsConfig.NextProtos = append(tlsConfig.NextProtos, proto)
+		}
+		key.nextProtos = strings.Join(tlsConfig.NextProtos, ",")
+	}
+	key.forceHTTP2 = forceHTTP2
+
+	clientHello := d.Get("tls_client_hello").(string)
+	if clientHello != "" && forceHTTP2 {
+		return append(diags, diag.Errorf("tls_client_hello only supports HTTP/1.1, require_protocol cannot be HTTP/2.0")...)
+	}
+	key.clientHello = clientHello
+
+	client_crt, ok, err := getPEM(d, "client_crt")
+	if err != nil {
+		return append(diags, diag.Errorf("Error decoding client_crt_base64: %s", err)...)
+	}
+	keyVault, keyVaultSet := d.GetOk("client_key_vault")
+	keyPKCS11, keyPKCS11Set := d.GetOk("client_key_pkcs11")
+	if ok && (keyVaultSet || keyPKCS11Set) && d.Get("dry_run").(bool) {
+		// dry_run connects neither to the target nor to Vault or the token
+	} else if ok && keyPKCS11Set {
+		clientCerts, err := pkcs11Certificate([]byte(client_crt), keyPKCS11.([]interface{})[0].(map[string]interface{}))
+		if err != nil {
+			return append(diags, diag.Errorf("Error loading client_key_pkcs11: %s", err)...)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCerts}
+	} else if ok {
+		client_key, ok, err := getPEM(d, "client_key")
+		if err != nil {
+			return append(diags, diag.Errorf("Error decoding client_key_base64: %s", err)...)
+		}
+		if keyVaultSet {
+			// read on every request and never stored in state
+			key, err := readVaultSecret(ctx, keyVault.([]interface{})[0].(map[string]interface{}))
+			if err != nil {
+				return append(diags, diag.Errorf("Error reading client_key_vault: %s", err)...)
+			}
+			client_key, ok = key, true
+		}
+		if !ok {
+			return append(diags, diag.Errorf("Both client_crt and client_key must be specified")...)
+		}
+		clientCerts, err := x509KeyPair(
+			[]byte(client_crt),
+			[]byte(client_key),
+			d.Get("client_key_password").(string),
+		)
+		if err != nil {
+			return append(diags, diag.Errorf("Error loading client certificates: %s", err)...)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCerts}
+	} else if keyVaultSet {
+		return append(diags, diag.Errorf("client_key_vault requires client_crt")...)
+	} else if keyPKCS11Set {
+		return append(diags, diag.Errorf("client_key_pkcs11 requires client_crt")...)
+	} else if crtFile, ok := d.GetOk("client_crt_file"); ok {
+		// read on every request so certificates rotated on disk are picked up
+		crtPEM, err := ioutil.ReadFile(crtFile.(string))
+		if err != nil {
+			return append(diags, diag.Errorf("Error loading client certificate files: %s", err)...)
+		}
+		keyPEM, err := ioutil.ReadFile(d.Get("client_key_file").(string))
+		if err != nil {
+			return append(diags, diag.Errorf("Error loading client certificate files: %s", err)...)
+		}
+		clientCerts, err := x509KeyPair(crtPEM, keyPEM, d.Get("client_key_password").(string))
+		if err != nil {
+			return append(diags, diag.Errorf("Error loading client certificate files: %s", err)...)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCerts}
+	}
+
+	// tls_client_hello presents it through the GetClientCertificate of uTLS
+	var clientCertFor func(host string) *tls.Certificate
+	providerClientCert := false
+	if len(tlsConfig.Certificates) > 0 {
+		clientCert := tlsConfig.Certificates[0]
+		certChain := sha256.New()
+		for _, der := range clientCert.Certificate {
+			certChain.Write(der)
+		}
+		key.clientCert = hex.EncodeToString(certChain.Sum(nil))
+		clientCertFor = staticClientCertificate(clientCert)
+	} else if config, ok := meta.(*providerConfig); ok && (len(config.clientCertificates) > 0 || config.defaultClientCertificate != nil) {
+		// chosen by the host of each connection, which a redirect or page may change;
+		// every read of the provider shares the same certificates
+		key.clientCert = "provider"
+		clientCertFor = hostClientCertificate(config.clientCertificates, config.defaultClientCertificate)
+		providerClientCert = true
+	}
+	if clientCertFor != nil {
+		// only called when the server asks for a certificate
+		tlsConfig.Certificates = nil
+		tlsConfig.GetClientCertificate = getClientCertificate(clientCertFor)
+	}
+
+	// the transport only adds and decodes gzip itself; any other encoding is passed through as-is
+	acceptEncoding := d.Get("accept_encoding").(string)
+	key.disableCompression = d.Get("disable_auto_decompress").(bool) || (acceptEncoding != "" && acceptEncoding != "gzip")
+	key.maxResponseHeaderBytes = d.Get("max_response_header_bytes").(int)
+
+	proxyConnectHeaders := http.Header{}
+	for name, value := range d.Get("proxy_connect_headers").(map[string]interface{}) {
+		proxyConnectHeaders.Set(name, value.(string))
+	}
+	if len(proxyConnectHeaders) > 0 {
+		var b strings.Builder
+		if err := proxyConnectHeaders.Write(&b); err != nil {
+			return append(diags, diag.Errorf("Error reading proxy_connect_headers: %s", err)...)
+		}
+		key.proxyConnectHeaders = b.String()
+	}
+
+	timeout_override, ok := d.GetOk("request_timeout_ms")
+	var timeout int
+	if ok {
+		if timeout, ok = timeout_override.(int); !ok {
+			return append(diags, diag.Errorf("Error overriding request_timeout_ms")...)
+		}
+	}
+
+	proxyURL := d.Get("proxy_url").(string)
+	if proxyURL != "" {
+		if u, err := neturl.Parse(proxyURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return append(diags, diag.Errorf("proxy_url must be an absolute URL such as http://proxy:3128, got %q", proxyURL)...)
+		}
+	}
+	var noProxyHosts []string
+	for _, h := range d.Get("no_proxy_hosts").([]interface{}) {
+		noProxyHosts = append(noProxyHosts, h.(string))
+	}
+	key.proxy = proxyURL + " " + strings.Join(noProxyHosts, ",")
+
+	var localIP net.IP
+	if name := d.Get("interface").(string); name != "" {
+		if localIP, err = interfaceAddr(name); err != nil {
+			return append(diags, diag.Errorf("Error resolving interface: %s", err)...)
+		}
+		key.localIP = localIP.String()
+	}
+
+	var pool *transportPool
+	if config, ok := meta.(*providerConfig); ok {
+		pool = config.transports
+	}
+	maxRedirects := d.Get("max_redirects").(int)
+	if maxRedirects < 0 {
+		return append(diags, diag.Errorf("max_redirects must not be negative")...)
+	}
+	// shared with every read with the same settings, and so are its connections
+	ckey := clientPoolKey{
+		transport:            key,
+		timeout:              time.Duration(timeout) * time.Millisecond,
+		restrictRedirectHost: d.Get("restrict_redirect_host").(bool),
+		httpsOnlyRedirects:   d.Get("https_only_redirects").(bool),
+		maxRedirects:         maxRedirects,
+		resendBodyOnRedirect: d.Get("resend_body_on_redirect").(bool),
+		redirectStripHeaders: strings.Join(redirectStripHeaders(d), ","),
+	}
+	client := pool.client(ckey, func() *http.Transport {
+		tr := &http.Transport{
+			TLSClientConfig: tlsConfig,
+			Proxy:           proxyFunc(proxyURL, noProxyHosts),
+			// a custom TLSClientConfig disables HTTP/2 unless explicitly asked for
+			ForceAttemptHTTP2:      forceHTTP2,
+			DisableCompression:     key.disableCompression,
+			MaxResponseHeaderBytes: int64(key.maxResponseHeaderBytes),
+			IdleConnTimeout:        90 * time.Second,
+		}
+		dialer := &net.Dialer{}
+		if localIP != nil {
+			// only addresses of the same family are then dialed
+			dialer.LocalAddr = &net.TCPAddr{IP: localIP}
+		}
+		dial := dialer.DialContext
+		if config, ok := meta.(*providerConfig); ok && config.dnsCache != nil {
+			dial = config.dnsCache.dialContext(dialer)
+		}
+		tr.DialContext = recordingDialer(dial)
+		if clientHello != "" {
+			// not used for requests through a proxy, which the transport wraps in its own TLS
+			tr.DialTLSContext = clientHelloDialer(tr.DialContext, tlsConfig, clientCertFor, clientHello)
+		}
+		if len(proxyConnectHeaders) > 0 {
+			tr.ProxyConnectHeader = proxyConnectHeaders
+		}
+		return tr
+	}, func(tr *http.Transport) *http.Client {
+		return &http.Client{
+			Transport:     tr,
+			Timeout:       ckey.timeout,
+			CheckRedirect: checkRedirect(ckey),
+		}
+	})
+	// the proxy function the pooled transport actually dials with
+	var transportProxy func(*http.Request) (*neturl.URL, error)
+	if tr, ok := client.Transport.(*http.Transport); ok {
+		transportProxy = tr.Proxy
+	}
+	// request_body_url and the kms_signer of request_nonce are called with the
+	// same proxy and TLS settings, outside of the rate limit and traffic counts
+	// of the read
+	pooledClient := client
+	if providerClientCert {
+		client = clientCertHostClient(client)
+	}
+	if config, ok := meta.(*providerConfig); ok && config.rateLimiter != nil && !d.Get("bypass_rate_limit").(bool) {
+		client = rateLimitedClient(client, config.rateLimiter)
+	}
+	// the client is shared, only count the traffic of this read
+	traffic := &byteCounter{}
+	client = traffic.client(client)
+
+	verb := http.MethodGet
+
+	method_override, methodSet := d.GetOk("method")
+	if methodSet {
+		if verb, ok = method_override.(string); !ok {
+			return append(diags, diag.Errorf("Error overriding verb")...)
+		}
+	}
+
+	var body io.Reader
+	var requestBody, renderedBody string
+	b, ok := d.GetOk("request_body")
+	if ok {
+		renderedBody = b.(string)
+	} else if b, ok = d.GetOk("sensitive_request_body"); ok {
+		renderedBody = redacted
+	}
+	if ok {
+		// an explicitly set method is always honored, even GET with a body
+		if !methodSet {
+			verb = http.MethodPost
+		}
+		requestBody = b.(string)
+		body = bytes.NewReader([]byte(requestBody))
+	}
+
+	jsonBody, isJSONBody := d.GetOk("json_body")
+	if isJSONBody {
+		b, err := json.Marshal(jsonBody)
+		if err != nil {
+			return append(diags, diag.Errorf("Error encoding json_body: %s", err)...)
+		}
+		if !methodSet {
+			verb = http.MethodPost
+		}
+		requestBody = string(b)
+		renderedBody = requestBody
+		body = bytes.NewReader(b)
+	}
+
+	var bodyFile *os.File
+	// of a request_body_url, -1 if unknown
+	bodyLength := int64(-1)
+	// streamed bodies are not held in memory so cannot be signed
+	var streamedBody bool
+	var b64Body *readErrorBody
+	if path, ok := d.GetOk("request_body_file"); ok {
+		// streamed rather than read into memory, it may be a pipe
+		if bodyFile, err = os.Open(path.(string)); err != nil {
+			return append(diags, diag.Errorf("Error opening request_body_file: %s", err)...)
+		}
+		defer bodyFile.Close()
+		if !methodSet {
+			verb = http.MethodPost
+		}
+		body = bodyFile
+		streamedBody = true
+		renderedBody = fmt.Sprintf("<contents of %s>", path.(string))
+	} else if path, ok := d.GetOk("request_body_base64_file"); ok {
+		b64File, err := os.Open(path.(string))
+		if err != nil {
+			return append(diags, diag.Errorf("Error opening request_body_base64_file: %s", err)...)
+		}
+		defer b64File.Close()
+		if !methodSet {
+			verb = http.MethodPost
+		}
+		// decoded as it is streamed, line breaks in the file are ignored
+		b64Body = &readErrorBody{Reader: base64.NewDecoder(base64.StdEncoding, b64File)}
+		body = b64Body
+		streamedBody = true
+		renderedBody = fmt.Sprintf("<base64 decoded contents of %s>", path.(string))
+	} else if sourceURL, ok := d.GetOk("request_body_url"); ok {
+		if !methodSet {
+			verb = http.MethodPost
+		}
+		streamedBody = true
+		renderedBody = fmt.Sprintf("<response body of %s>", redactURL(sourceURL.(string)))
+		// dry_run does not connect to the source either
+		if !d.Get("dry_run").(bool) {
+			sourceClient := pooledClient
+			if providerClientCert {
+				sourceClient = clientCertHostClient(sourceClient)
+			}
+			source, err := getRequestBodyURL(ctx, sourceClient, sourceURL.(string))
+			if err != nil {
+				return append(diags, diag.Errorf("Error reading request_body_url: %s", err)...)
+			}
+			defer source.Body.Close()
+			body = source.Body
+			bodyLength = source.ContentLength
+		}
+	}
+
+	var remoteAddr, localAddr, resolvedIP string
+	var connReused, clientCertSent bool
+	var rawConn *recordingConn
+	certState := &clientCertState{}
+	// phases that did not happen (eg, on a reused connection) are left at zero
+	var requestStart, dnsStart, connectStart, tlsStart time.Time
+	var dnsTime, connectTime, tlsTime, ttfbTime time.Duration
+	var sentHeaders http.Header
+	// the TLS state of the last connection when made for tls_client_hello
+	var clientHelloTLS *tls.ConnectionState
+	trace := &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			// once per request, only keep the headers of the last one when redirected
+			sentHeaders = http.Header{}
+		},
+		WroteHeaderField: func(key string, value []string) {
+			// skip HTTP/2 pseudo headers such as :authority
+			if !strings.HasPrefix(key, ":") {
+				sentHeaders[http.CanonicalHeaderKey(key)] = append(sentHeaders[http.CanonicalHeaderKey(key)], value...)
+			}
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			dnsTime = time.Since(dnsStart)
+			if info.Err == nil && len(info.Addrs) > 0 {
+				resolvedIP = info.Addrs[0].IP.String()
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			// several addresses may be dialed in parallel; time from the first attempt
+			if connectStart.IsZero() {
+				connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				connectTime = time.Since(connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			tlsTime = time.Since(tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			ttfbTime = time.Since(requestStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			connReused = info.Reused
+			// the last connection is the one of the final response when redirected
+			rawConn, _ = info.Conn.(*recordingConn)
+			clientHelloTLS = clientHelloState(info.Conn)
+			if rawConn != nil {
+				rawConn.record()
+			}
+			clientCertSent = connClientCertSent(info.Conn, info.Reused, certState.wasSent())
+			remoteAddr = info.Conn.RemoteAddr().String()
+			localAddr = info.Conn.LocalAddr().String()
+			// no lookup happens for IP literals; use the connected address instead
+			if tcpAddr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok && resolvedIP == "" {
+				resolvedIP = tcpAddr.IP.String()
+			}
+		},
+	}
+
+	reqCtx, cancel := context.WithCancel(withClientCertState(httptrace.WithClientTrace(ctx, trace), certState))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, verb, url, body)
+	if err != nil {
+		return append(diags, diag.Errorf("Error creating request: %s", err)...)
+	}
+
+	if bodyLength == 0 {
+		req.Body = http.NoBody
+	} else if bodyLength > 0 {
+		// not sent chunked
+		req.ContentLength = bodyLength
+	}
+
+	if bodyFile != nil {
+		if err := setFileBody(req, bodyFile); err != nil {
+			return append(diags, diag.Errorf("Error reading request_body_file: %s", err)...)
+		}
+	}
+
+	if trailer, ok := d.GetOk("request_body_sha256_trailer"); ok {
+		if req.Body == nil || req.Body == http.NoBody {
+			return append(diags, diag.Errorf("request_body_sha256_trailer requires a request body")...)
+		}
+		setSHA256Trailer(req, trailer.(string))
+	}
+
+	var uploadBody *writeTimeoutBody
+	if writeTimeout := d.Get("write_timeout_ms").(int); writeTimeout > 0 && req.Body != nil {
+		// wraps req.Body rather than body so the Content-Length is still known
+		uploadBody = newWriteTimeoutBody(req.Body, time.Duration(writeTimeout)*time.Millisecond, cancel)
+		req.Body = uploadBody
+	}
+
+	for name, value := range headers {
+		req.Header.Set(name, value.(string))
+	}
+
+	// added in order, after any value from request_headers
+	for _, h := range d.Get("extra_headers").([]interface{}) {
+		header := h.(map[string]interface{})
+		req.Header.Add(header["name"].(string), header["value"].(string))
+	}
+
+	if isJSONBody {
+		setDefaultContentType(req, d, "application/json")
+	}
+
+	if acceptEncoding != "" && acceptEncoding != "gzip" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	if ims, ok := d.GetOk("if_modified_since"); ok {
+		req.Header.Set("If-Modified-Since", ims.(string))
+	}
+
+	// generated once per read so any resend of this request carries the same key
+	if req.Header.Get("Idempotency-Key") == "" {
+		idempotencyKey := d.Get("idempotency_key").(string)
+		if idempotencyKey == "" && verb == http.MethodPost {
+			if idempotencyKey, err = uuid.GenerateUUID(); err != nil {
+				return append(diags, diag.Errorf("Error generating idempotency_key: %s", err)...)
+			}
+		}
+		if idempotencyKey != "" {
+			req.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+	}
+
+	// called again for every retry and page, a resent nonce would be rejected
+	// as a replay
+	var setNonce func() diag.Diagnostics
+	var setPageNonce func(*http.Request) error
+	if settings, ok := d.GetOk("request_nonce"); ok {
+		nonceSettings := settings.([]interface{})[0].(map[string]interface{})
+		sign, err := nonceSigner(nonceSettings, pool, pooledClient)
+		if err != nil {
+			return append(diags, diag.Errorf("Error configuring request_nonce: %s", err)...)
+		}
+		if sign != nil && streamedBody {
+			return append(diags, diag.Errorf("request_nonce cannot sign a request_body_file, request_body_base64_file or request_body_url")...)
+		}
+		if len(nonceSettings["kms_signer"].([]interface{})) > 0 && d.Get("dry_run").(bool) {
+			// dry_run does not call the KMS, the signature header is left out
+			sign = nil
+		}
+		setPageNonce = func(pageReq *http.Request) error {
+			return setNonceHeaders(ctx, pageReq, nonceSettings, "", sign)
+		}
+		setNonce = func() diag.Diagnostics {
+			if err := setNonceHeaders(ctx, req, nonceSettings, requestBody, sign); err != nil {
+				return diag.Errorf("Error setting request_nonce headers: %s", err)
+			}
+			return nil
+		}
+		if nonceDiags := setNonce(); nonceDiags.HasError() {
+			return append(diags, nonceDiags...)
+		}
+	}
+
+	if d.Get("dry_run").(bool) {
+		rendered, err := renderRequest(req, renderedBody)
+		if err != nil {
+			return append(diags, diag.Errorf("Error rendering request: %s", err)...)
+		}
+		if err = d.Set("rendered_request", rendered); err != nil {
+			return append(diags, diag.Errorf("Error setting rendered_request: %s", err)...)
+		}
+		if err = d.Set("method", verb); err != nil {
+			return append(diags, diag.Errorf("Error setting method: %s", err)...)
+		}
+		d.SetId(url)
+		return diags
+	}
+
+	tokenVault, tokenVaultSet := d.GetOk("bearer_token_vault")
+	spnego, spnegoSet := d.GetOk("spnego")
+	// sets the Authorization header, again to refresh it after a 401
+	setAuthorization := func() diag.Diagnostics {
+		if tokenVaultSet {
+			token, err := readVaultSecret(ctx, tokenVault.([]interface{})[0].(map[string]interface{}))
+			if err != nil {
+				return diag.Errorf("Error reading bearer_token_vault: %s", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		// after dry_run, obtaining a ticket requires talking to the KDC
+		if spnegoSet {
+			if err := setSPNEGOHeader(req, spnego.([]interface{})[0].(map[string]interface{})); err != nil {
+				return diag.Errorf("Error setting SPNEGO header: %s", err)
+			}
+		}
+		return nil
+	}
+	if authDiags := setAuthorization(); authDiags.HasError() {
+		return append(diags, authDiags...)
+	}
+
+	refreshAuth := d.Get("refresh_auth_on_401").(bool)
+	if refreshAuth && !tokenVaultSet && !spnegoSet {
+		return append(diags, diag.Errorf("refresh_auth_on_401 requires bearer_token_vault or spnego")...)
+	}
+
+	maxRetries := d.Get("max_retries").(int)
+	if maxRetries < 0 {
+		return append(diags, diag.Errorf("max_retries must not be negative")...)
+	}
+	// a body read from a stream cannot be sent again
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxRetries = 0
+	}
+	retryWait := time.Duration(d.Get("retry_wait_ms").(int)) * time.Millisecond
+	maxRetryWait := time.Duration(d.Get("max_retry_wait_ms").(int)) * time.Millisecond
+	var retryBodyRegex *regexp.Regexp
+	if expr, ok := d.GetOk("retry_body_regex"); ok {
+		retryBodyRegex = regexp.MustCompile(expr.(string))
+	}
+
+	do := client.Do
+	if d.Get("coalesce_requests").(bool) {
+		var coalescer *requestCoalescer
+		if config, ok := meta.(*providerConfig); ok {
+			coalescer = config.requests
+		}
+		// for every attempt, a refreshed Authorization changes the key
+		do = func(req *http.Request) (*http.Response, error) {
+			requestKey, err := coalesceKey(req, ckey)
+			if err != nil {
+				return nil, fmt.Errorf("reading request body: %s", err)
+			}
+			return coalescer.do(client, req, requestKey)
+		}
+	}
+
+	var resp *http.Response
+	attemptsMade := 0
+	// the last response still matched retry_body_regex
+	bodyRetry := false
+	authRefreshed := false
+	for {
+		attemptsMade++
+		if attemptsMade > 1 && setNonce != nil {
+			if nonceDiags := setNonce(); nonceDiags.HasError() {
+				return append(diags, nonceDiags...)
+			}
+		}
+		requestStart = time.Now()
+		resp, err = do(req)
+		bodyRetry = false
+		if err == nil && retryBodyRegex != nil && !shouldRetry(resp, err) {
+			if bodyRetry, err = bodyMatches(resp, retryBodyRegex); err != nil {
+				resp = nil
+			}
+		}
+		// once, and only if the body can be sent again
+		authRetry := refreshAuth && !authRefreshed && err == nil && resp.StatusCode == http.StatusUnauthorized &&
+			(req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+		// the refreshed attempt does not use up max_retries
+		retriesMade := attemptsMade - 1
+		if authRefreshed {
+			retriesMade--
+		}
+		if !authRetry && (retriesMade >= maxRetries || !(bodyRetry || shouldRetry(resp, err)) || (uploadBody != nil && uploadBody.expired())) {
+			break
+		}
+
+		wait := retryBackoff(retryWait, retriesMade, maxRetryWait)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				wait = after
+			}
+			drainBody(resp.Body)
+		}
+		if authRetry {
+			// the token expired, a new one can be used right away
+			authRefreshed = true
+			if authDiags := setAuthorization(); authDiags.HasError() {
+				return append(diags, authDiags...)
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+				return append(diags, diag.Errorf("Error making request: %s", ctx.Err())...)
+			case <-time.After(wait):
+			}
+		}
+
+		if req.GetBody != nil {
+			retryBody, err := req.GetBody()
+			if err != nil {
+				return append(diags, diag.Errorf("Error resending request body: %s", err)...)
+			}
+			if uploadBody != nil {
+				uploadBody = newWriteTimeoutBody(retryBody, uploadBody.timeout, cancel)
+				retryBody = uploadBody
+			}
+			req.Body = retryBody
+		}
+	}
+	if err != nil {
+		if uploadBody != nil && uploadBody.expired() {
+			return append(diags, diag.Errorf("Error making request: request body upload exceeded write_timeout_ms %d", d.Get("write_timeout_ms").(int))...)
+		}
+		// the transport only reports the aborted upload
+		if b64Body != nil && b64Body.error() != nil {
+			return append(diags, diag.Errorf("Error decoding request_body_base64_file: %s", b64Body.error())...)
+		}
+		if attemptsMade > 1 {
+			return append(diags, diag.Errorf("Error making request after %d attempts: %s", attemptsMade, err)...)
+		}
+		return append(diags, diag.Errorf("Error making request: %s", err)...)
+	}
+
+	// every return below drains the body so the connection goes back to the
+	// pool, except when read_limit_bytes cut it short on purpose
+	var limitedBody *truncatingReader
+	respBody := resp.Body
+	defer func() {
+		if limitedBody != nil && limitedBody.truncated {
+			respBody.Close()
+			return
+		}
+		drainBody(respBody)
+	}()
+	if resp.TLS == nil {
+		resp.TLS = clientHelloTLS
+	}
+
+	if bodyRetry {
+		return append(diags, diag.Errorf("HTTP request error. Response body still matches retry_body_regex after %d attempts: %s", attemptsMade, retryBodyRegex)...)
+	}
+	// compared to the Date header, which the server set before sending the headers
+	receivedAt := time.Now()
+
+	if err = d.Set("attempts_made", attemptsMade); err != nil {
+		return append(diags, diag.Errorf("Error setting attempts_made: %s", err)...)
+	}
+
+	// before the connection can be reused by another read
+	var rawResponseHeaders string
+	if rawConn != nil {
+		rawResponseHeaders = rawConn.recorded()
+	}
+
+	if maxDownloadTime := d.Get("max_download_time_ms").(int); maxDownloadTime > 0 {
+		downloadBody := newDownloadTimeoutBody(resp.Body, maxDownloadTime, cancel)
+		defer downloadBody.stop()
+		resp.Body = downloadBody
+	}
+
+	// TODO, check if the response code is valid for the verb sent in...
+
+	if requireProtocol != "" && resp.Proto != requireProtocol {
+		return append(diags, diag.Errorf("Response protocol is %s, require_protocol is %s", resp.Proto, requireProtocol)...)
+	}
+
+	notModified := resp.StatusCode == http.StatusNotModified && req.Header.Get("If-Modified-Since") != ""
+
+	successWhen := d.Get("success_when").(string)
+
+	// the client returns the redirects it has nowhere to follow as the response
+	missingLocation := isRedirectStatus(resp.StatusCode) && resp.Header.Get("Location") == ""
+	acceptMissingLocation := missingLocation && d.Get("accept_redirect_without_location").(bool)
+
+	errorStatus := !(resp.StatusCode >= 200 && resp.StatusCode < 300) && !notModified && !acceptMissingLocation && successWhen == ""
+
+	if errorStatus && !d.Get("fail_on_error_status").(bool) {
+		detail := fmt.Sprintf("Response code: %d, the response is stored as fail_on_error_status is false.", resp.StatusCode)
+		if missingLocation {
+			detail = fmt.Sprintf("Response code: %d is a redirect without a Location header, the response is stored as fail_on_error_status is false.", resp.StatusCode)
+		}
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "HTTP request error",
+			Detail:   detail,
+		})
+	} else if errorStatus && missingLocation {
+		return append(diags, diag.Errorf("HTTP request error. Response code: %d is a redirect without a Location header, set accept_redirect_without_location to return it", resp.StatusCode)...)
+	} else if errorStatus {
+
+		bytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return append(diags, diag.Errorf("HTTP request error. Response code: %d", resp.StatusCode)...)
+		}
+		if path, ok := d.GetOk("error_message_jsonpath"); ok {
+			// falls back to the whole body when it has no such message
+			if message, err := jsonPathString(bytes, path.(string)); err == nil && message != "" {
+				return append(diags, diag.Errorf("HTTP request error. Response code: %d,  Error message: %s", resp.StatusCode, message)...)
+			}
+		}
+		return append(diags, diag.Errorf("HTTP request error. Response code: %d,  Error Response body: %s", resp.StatusCode, string(bytes))...)
+	}
+
+	if minValidityDays > 0 && resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		if err := checkCertValidity(resp.TLS.PeerCertificates[0], minValidityDays); err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "Server certificate expires soon",
+				Detail:   err.Error(),
+			})
+		}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	// multipart bodies are split into response_parts instead
+	isMultipart := strings.HasPrefix(strings.ToLower(contentType), "multipart/")
+	if !notModified && !isMultipart && (contentType == "" || isContentTypeText(contentType) == false) {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Content-Type is not recognized as a text type, got %q", contentType),
+			Detail:   "If the content is binary data, Terraform may not properly handle the contents of the response.",
+		})
+	}
+
+	var bodyReader io.Reader = resp.Body
+	if !d.Get("disable_auto_decompress").(bool) {
+		if bodyReader, err = decodeContentEncoding(resp); err != nil {
+			return append(diags, diag.Errorf("Error decoding response body: %s", err)...)
+		}
+	}
+
+	if limit := d.Get("read_limit_bytes").(int); limit > 0 {
+		// the rest is never downloaded, the body is closed when returning
+		limitedBody = &truncatingReader{r: bodyReader, n: int64(limit)}
+		bodyReader = limitedBody
+	}
+
+	var bytes []byte
+	var ndjsonObjects []string
+	if d.Get("ndjson").(bool) {
+		var timedOut bool
+		bytes, ndjsonObjects, timedOut, err = readNDJSON(bodyReader)
+		if err != nil {
+			return append(diags, diag.Errorf("Error reading ndjson response: %s", err)...)
+		}
+		if timedOut {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "ndjson stream timed out",
+				Detail:   fmt.Sprintf("Only the %d objects received before the timeout are returned.", len(ndjsonObjects)),
+			})
+		}
+	} else if bytes, err = ioutil.ReadAll(bodyReader); err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+	rawBody := bytes
+
+	if err = d.Set("body_truncated", limitedBody != nil && limitedBody.truncated); err != nil {
+		return append(diags, diag.Errorf("Error setting body_truncated: %s", err)...)
+	}
+
+	// a 304 never has a body
+	if d.Get("require_non_empty_body").(bool) && len(bytes) == 0 && !notModified {
+		return append(diags, diag.Errorf("HTTP request error. Response body is empty and require_non_empty_body is set. Response code: %d", resp.StatusCode)...)
+	}
+
+	if charset, ok := d.GetOk("response_charset"); ok {
+		if bytes, err = decodeCharset(bytes, charset.(string)); err != nil {
+			return append(diags, diag.Errorf("Error decoding response body: %s", err)...)
+		}
+	} else if decoded, ok := decodeBOM(bytes); ok {
+		// as in browsers, a byte order mark takes precedence over the Content-Type charset
+		bytes = decoded
+	} else if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		// best effort, an unknown charset was already flagged by the warning above
+		if decoded, err := decodeCharset(bytes, params["charset"]); err == nil {
+			bytes = decoded
+		}
+	}
+
+	responseHeaders := make(map[string]string)
+	for k, v := range resp.Header {
+		// Concatenate according to RFC2616
+		// cf. https://www.w3.org/Protocols/rfc2616/rfc2616-sec4.html#sec4.2
+		responseHeaders[k] = strings.Join(v, ", ")
+	}
+
+	if successWhen != "" {
+		ok, err := evalSuccessWhen(successWhen, resp.StatusCode, responseHeaders, string(bytes))
+		if err != nil {
+			return append(diags, diag.Errorf("Error evaluating success_when: %s", err)...)
+		}
+		if !ok {
+			return append(diags, diag.Errorf("HTTP request error. Response does not satisfy success_when. Response code: %d,  Response body: %s", resp.StatusCode, string(bytes))...)
+		}
+	}
+
+	expectedHeaders := d.Get("expected_response_headers").(map[string]interface{})
+	if len(expectedHeaders) > 0 {
+		var mismatches []string
+		for name, want := range expectedHeaders {
+			got := strings.Join(resp.Header.Values(name), ", ")
+			if !strings.EqualFold(got, want.(string)) {
+				mismatches = append(mismatches, fmt.Sprintf("%s: got %q, want %q", name, got, want))
+			}
+		}
+		if len(mismatches) > 0 {
+			sort.Strings(mismatches)
+			return append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  "Response headers do not match expected_response_headers",
+				Detail:   strings.Join(mismatches, "\n"),
+			})
+		}
+	}
+
+	if jsonSchema, ok := d.GetOk("response_json_schema"); ok {
+		if schemaDiags := validateJSONSchema(jsonSchema.(string), bytes); schemaDiags.HasError() {
+			return append(diags, schemaDiags...)
+		}
+	}
+
+	if settings, ok := d.GetOk("validate_against_openapi"); ok {
+		openAPI := settings.([]interface{})[0].(map[string]interface{})
+		if openAPIDiags := validateOpenAPI(ctx, openAPI["spec_file"].(string), openAPI["operation_id"].(string), resp, bytes); openAPIDiags.HasError() {
+			return append(diags, openAPIDiags...)
+		}
+	}
+
+	var metricValues []map[string]interface{}
+	if d.Get("parse_prometheus").(bool) {
+		metricName := d.Get("metric_name").(string)
+		if metricName == "" {
+			return append(diags, diag.Errorf("metric_name must be set with parse_prometheus")...)
+		}
+		samples, err := parsePrometheusMetric(bytes, metricName)
+		if err != nil {
+			return append(diags, diag.Errorf("Error parsing Prometheus metrics: %s", err)...)
+		}
+		for _, sample := range samples {
+			metricValues = append(metricValues, map[string]interface{}{
+				"labels": sample.labels,
+				"value":  sample.value,
+			})
+		}
+	}
+
+	var transformedBody string
+	if expr, ok := d.GetOk("jq"); ok {
+		if transformedBody, err = transformJSON(expr.(string), bytes); err != nil {
+			return append(diags, diag.Errorf("Error applying jq: %s", err)...)
+		}
+	}
+
+	if err = d.Set("transformed_body", transformedBody); err != nil {
+		return append(diags, diag.Errorf("Error setting transformed_body: %s", err)...)
+	}
+
+	var pages []string
+	if settings, ok := d.GetOk("paginate"); ok && !notModified {
+		paginateSettings := settings.([]interface{})[0].(map[string]interface{})
+		nextHeader := paginateSettings["next_header"].(string)
+		nextJSONPath := paginateSettings["next_jsonpath"].(string)
+		if (nextHeader == "") == (nextJSONPath == "") {
+			return append(diags, diag.Errorf("paginate requires exactly one of next_header and next_jsonpath")...)
+		}
+		if paginateSettings["max_pages"].(int) < 1 {
+			return append(diags, diag.Errorf("paginate max_pages must be at least 1")...)
+		}
+		p := &paginator{
+			client:            client,
+			header:            req.Header,
+			nextHeader:        nextHeader,
+			nextJSONPath:      nextJSONPath,
+			maxPages:          paginateSettings["max_pages"].(int),
+			disableDecompress: d.Get("disable_auto_decompress").(bool),
+			responseCharset:   d.Get("response_charset").(string),
+			setNonce:          setPageNonce,
+			stripHeaders:      strings.Split(ckey.redirectStripHeaders, ","),
+		}
+		var truncated bool
+		if pages, truncated, err = p.follow(ctx, req.URL, resp, bytes); err != nil {
+			return append(diags, diag.Errorf("Error following paginate: %s", err)...)
+		}
+		if truncated {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "paginate stopped at max_pages",
+				Detail:   fmt.Sprintf("Only the first %d pages are returned in pages, there are more.", len(pages)),
+			})
+		}
+	}
+
+	if err = d.Set("pages", pages); err != nil {
+		return append(diags, diag.Errorf("Error setting pages: %s", err)...)
+	}
+
+	// every attempt, redirect and page has been read by now
+	if err = d.Set("request_bytes_sent", int(traffic.bytesSent())); err != nil {
+		return append(diags, diag.Errorf("Error setting request_bytes_sent: %s", err)...)
+	}
+	if err = d.Set("response_bytes_received", int(traffic.bytesReceived())); err != nil {
+		return append(diags, diag.Errorf("Error setting response_bytes_received: %s", err)...)
+	}
+
+	if unwrapKey := d.Get("unwrap_json_key").(string); unwrapKey != "" && !notModified {
+		// after jq and paginate, which work on the whole envelope
+		if bytes, err = unwrapJSON(bytes, unwrapKey); err != nil {
+			return append(diags, diag.Errorf("Error unwrapping unwrap_json_key: %s", err)...)
+		}
+	}
+
+	regexCapturesMap := map[string]string{}
+	if expr, ok := d.GetOk("response_body_regex"); ok {
+		regexCapturesMap = regexCaptures(expr.(string), bytes)
+	}
+
+	if err = d.Set("response_body_regex_captures", regexCapturesMap); err != nil {
+		return append(diags, diag.Errorf("Error setting response_body_regex_captures: %s", err)...)
+	}
+
+	if err = d.Set("method", verb); err != nil {
+		return append(diags, diag.Errorf("Error setting method: %s", err)...)
+	}
+
+	if err = d.Set("status_code", resp.StatusCode); err != nil {
+		return append(diags, diag.Errorf("Error setting HTTP status_code: %s", err)...)
+	}
+
+	responseBody := string(bytes)
+	var responseBodyBase64, responseBodyFile string
+	// response_body_base64 is of the body as received, before unwrap_json_key
+	if config, ok := meta.(*providerConfig); ok && config.maxInlineBodyBytes > 0 &&
+		(len(bytes) > config.maxInlineBodyBytes || len(rawBody) > config.maxInlineBodyBytes) {
+		// keep large bodies out of state
+		if responseBodyFile, err = writeBodyFile(url, bytes); err != nil {
+			return append(diags, diag.Errorf("Error writing body_file: %s", err)...)
+		}
+		responseBody = ""
+	} else if d.Get("response_body_hex_decode").(bool) {
+		// the hex may be wrapped over several lines
+		decoded, err := hex.DecodeString(strings.Join(strings.Fields(string(rawBody)), ""))
+		if err != nil {
+			return append(diags, diag.Errorf("Error hex decoding response body: %s", err)...)
+		}
+		responseBodyBase64 = base64.StdEncoding.EncodeToString(decoded)
+	} else if d.Get("include_response_body_base64").(bool) || !utf8.Valid(rawBody) {
+		// a second, larger copy of a text body, only stored when asked for
+		responseBodyBase64 = base64.StdEncoding.EncodeToString(rawBody)
+	}
+
+	if err = d.Set("body_file", responseBodyFile); err != nil {
+		return append(diags, diag.Errorf("Error setting body_file: %s", err)...)
+	}
+
+	// another copy of the body, so not for those kept out of state
+	var parsedBody string
+	if !notModified && responseBodyFile == "" {
+		if parsedBody, err = parseBody(contentType, bytes); err != nil {
+			// not an error, the read would fail for everyone not using parsed_body
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "parsed_body is empty",
+				Detail:   err.Error(),
+			})
+			parsedBody = ""
+		}
+	}
+
+	if err = d.Set("parsed_body", parsedBody); err != nil {
+		return append(diags, diag.Errorf("Error setting parsed_body: %s", err)...)
+	}
+
+	if err = d.Set("response_body", responseBody); err != nil {
+		return append(diags, diag.Errorf("Error setting HTTP response body: %s", err)...)
+	}
+
+	// another copy of the body, only stored when asked for
+	var responseLines []string
+	if d.Get("split_response_lines").(bool) && isContentTypeText(contentType) {
+		responseLines = splitLines(responseBody)
+	}
+
+	if err = d.Set("response_lines", responseLines); err != nil {
+		return append(diags, diag.Errorf("Error setting response_lines: %s", err)...)
+	}
+
+	if err = d.Set("response_body_base64", responseBodyBase64); err != nil {
+		return append(diags, diag.Errorf("Error setting HTTP response body base64: %s", err)...)
+	}
+
+	var responseParts []map[string]interface{}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && isMultipart {
+		if responseParts, err = parseMultipartBody(rawBody, params["boundary"]); err != nil {
+			return append(diags, diag.Errorf("Error parsing multipart response: %s", err)...)
+		}
+	}
+
+	if err = d.Set("ndjson_objects", ndjsonObjects); err != nil {
+		return append(diags, diag.Errorf("Error setting ndjson_objects: %s", err)...)
+	}
+
+	if err = d.Set("response_parts", responseParts); err != nil {
+		return append(diags, diag.Errorf("Error setting response_parts: %s", err)...)
+	}
+
+	if err = d.Set("metric_values", metricValues); err != nil {
+		return append(diags, diag.Errorf("Error setting metric_values: %s", err)...)
+	}
+
+	if err = d.Set("response_headers", responseHeaders); err != nil {
+		return append(diags, diag.Errorf("Error setting HTTP response headers: %s", err)...)
+	}
+
+	if err = d.Set("response_cookies_detail", cookieDetails(resp.Cookies())); err != nil {
+		return append(diags, diag.Errorf("Error setting response_cookies_detail: %s", err)...)
+	}
+
+	// only populated once the body was read to the end
+	responseTrailers := make(map[string]string)
+	for k, v := range resp.Trailer {
+		if len(v) > 0 {
+			responseTrailers[k] = strings.Join(v, ", ")
+		}
+	}
+
+	if err = d.Set("raw_response_headers", rawResponseHeaders); err != nil {
+		return append(diags, diag.Errorf("Error setting raw_response_headers: %s", err)...)
+	}
+
+	if err = d.Set("response_trailers", responseTrailers); err != nil {
+		return append(diags, diag.Errorf("Error setting HTTP response trailers: %s", err)...)
+	}
+
+	if err = d.Set("body", responseBody); err != nil {
+		return append(diags, diag.Errorf("Error setting HTTP response body: %s", err)...)
+	}
+
+	var allowedMethods []string
+	if verb == http.MethodOptions {
+		for _, v := range resp.Header.Values("Allow") {
+			for _, m := range strings.Split(v, ",") {
+				if m = strings.TrimSpace(m); m != "" {
+					allowedMethods = append(allowedMethods, strings.ToUpper(m))
+				}
+			}
+		}
+	}
+
+	if err = d.Set("allowed_methods", allowedMethods); err != nil {
+		return append(diags, diag.Errorf("Error setting allowed_methods: %s", err)...)
+	}
+
+	if err = d.Set("not_modified", notModified); err != nil {
+		return append(diags, diag.Errorf("Error setting not_modified: %s", err)...)
+	}
+
+	if err = d.Set("last_modified", resp.Header.Get("Last-Modified")); err != nil {
+		return append(diags, diag.Errorf("Error setting last_modified: %s", err)...)
+	}
+
+	var serverTime string
+	var clockSkewMs int64
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		serverTime = date.UTC().Format(time.RFC3339)
+		clockSkewMs = date.Sub(receivedAt).Milliseconds()
+	}
+
+	if err = d.Set("server_time", serverTime); err != nil {
+		return append(diags, diag.Errorf("Error setting server_time: %s", err)...)
+	}
+
+	if err = d.Set("clock_skew_ms", clockSkewMs); err != nil {
+		return append(diags, diag.Errorf("Error setting clock_skew_ms: %s", err)...)
+	}
+
+	if err = d.Set("idempotency_key", req.Header.Get("Idempotency-Key")); err != nil {
+		return append(diags, diag.Errorf("Error setting idempotency_key: %s", err)...)
+	}
+
+	if err = d.Set("effective_request_headers", redactHeaders(sentHeaders)); err != nil {
+		return append(diags, diag.Errorf("Error setting effective_request_headers: %s", err)...)
+	}
+
+	var peerCertificates []string
+	if resp.TLS != nil {
+		for _, cert := range resp.TLS.PeerCertificates {
+			peerCertificates = append(peerCertificates, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+		}
+	}
+
+	if err = d.Set("tls_peer_certificates_pem", peerCertificates); err != nil {
+		return append(diags, diag.Errorf("Error setting tls_peer_certificates_pem: %s", err)...)
+	}
+
+	if err = d.Set("client_cert_sent", clientCertSent); err != nil {
+		return append(diags, diag.Errorf("Error setting client_cert_sent: %s", err)...)
+	}
+
+	if err = d.Set("remote_addr", remoteAddr); err != nil {
+		return append(diags, diag.Errorf("Error setting remote_addr: %s", err)...)
+	}
+
+	var proxyAddr string
+	if transportProxy != nil {
+		// for the request of the final response, after any redirect
+		if u, err := transportProxy(resp.Request); err == nil && u != nil {
+			proxyAddr = proxyHostPort(u)
+		}
+	}
+	if err = d.Set("used_proxy", proxyAddr != ""); err != nil {
+		return append(diags, diag.Errorf("Error setting used_proxy: %s", err)...)
+	}
+	if err = d.Set("proxy_addr", proxyAddr); err != nil {
+		return append(diags, diag.Errorf("Error setting proxy_addr: %s", err)...)
+	}
+
+	if err = d.Set("local_addr", localAddr); err != nil {
+		return append(diags, diag.Errorf("Error setting local_addr: %s", err)...)
+	}
+
+	if err = d.Set("resolved_ip", resolvedIP); err != nil {
+		return append(diags, diag.Errorf("Error setting resolved_ip: %s", err)...)
+	}
+
+	if err = d.Set("connection_reused", connReused); err != nil {
+		return append(diags, diag.Errorf("Error setting connection_reused: %s", err)...)
+	}
+
+	for k, v := range map[string]time.Duration{
+		"dns_ms":     dnsTime,
+		"connect_ms": connectTime,
+		"tls_ms":     tlsTime,
+		"ttfb_ms":    ttfbTime,
+	} {
+		if err = d.Set(k, v.Milliseconds()); err != nil {
+			return append(diags, diag.Errorf("Error setting %s: %s", k, err)...)
+		}
+	}
+
+	// set ID as something more stable than time
+	d.SetId(url)
+
+	return diags
+}
+
+// expandPathParams replaces each {name} token in rawURL with the path escaped value
+func expandPathParams(rawURL string, params map[string]interface{}) (string, error) {
+	for name, value := range params {
+		token := "{" + name + "}"
+		if !strings.Contains(rawURL, token) {
+			return "", fmt.Errorf("%s not found in url", token)
+		}
+		rawURL = strings.ReplaceAll(rawURL, token, neturl.PathEscape(value.(string)))
+	}
+	return rawURL, nil
+}
+
+// setDefaultContentType is how request body attributes set the Content-Type
+// they imply. It never overrides one from request_headers and is skipped with
+// no_default_content_type.
+func setDefaultContentType(req *http.Request, d *schema.ResourceData, contentType string) {
+	if d.Get("no_default_content_type").(bool) {
+		return
+	}
+	if _, ok := req.Header["Content-Type"]; ok {
+		return
+	}
+	req.Header.Set("Content-Type", contentType)
+}
+
+// setFileBody sets the length of a regular file body so it is not sent chunked
+// and allows it to be resent on redirects by reopening it. Anything else, such
+// as a pipe, is sent chunked and can only be read once.
+func setFileBody(req *http.Request, f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	req.ContentLength = fi.Size()
+	if req.ContentLength == 0 {
+		req.Body = http.NoBody
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return os.Open(f.Name())
+	}
+	return nil
+}
+
+// getRequestBodyURL GETs the source of request_body_url with client, whose body
+// is then streamed as the request body. Headers and credentials meant for url
+// are not sent.
+func getRequestBodyURL(ctx context.Context, client *http.Client, sourceURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		drainBody(resp.Body)
+		return nil, fmt.Errorf("GET %s: response code %d", redactURL(sourceURL), resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// proxyFunc selects the proxy like http.ProxyFromEnvironment, with proxyURL
+// replacing HTTP_PROXY and HTTPS_PROXY and noProxyHosts added to NO_PROXY
+func proxyFunc(proxyURL string, noProxyHosts []string) func(*http.Request) (*neturl.URL, error) {
+	cfg := httpproxy.FromEnvironment()
+	if proxyURL != "" {
+		cfg.HTTPProxy = proxyURL
+		cfg.HTTPSProxy = proxyURL
+	}
+	if len(noProxyHosts) > 0 {
+		cfg.NoProxy = strings.Join(append([]string{cfg.NoProxy}, noProxyHosts...), ",")
+	}
+	proxy := cfg.ProxyFunc()
+	return func(req *http.Request) (*neturl.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// proxyHostPort is the address the transport connects to for the proxy u,
+// with the default port of its scheme
+func proxyHostPort(u *neturl.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	switch u.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// redirectStripHeaders are the canonical names of the headers not sent to
+// another host than the one in url: sensitiveHeaders, redirect_strip_headers
+// and those of request_nonce, which the other host has no use for
+func redirectStripHeaders(d *schema.ResourceData) []string {
+	names := append([]string{}, sensitiveHeaders...)
+	for _, name := range d.Get("redirect_strip_headers").([]interface{}) {
+		names = append(names, name.(string))
+	}
+	if settings, ok := d.GetOk("request_nonce"); ok {
+		nonceSettings := settings.([]interface{})[0].(map[string]interface{})
+		for _, field := range []string{"timestamp_header", "nonce_header", "signature_header"} {
+			names = append(names, nonceSettings[field].(string))
+		}
+	}
+
+	seen := map[string]bool{}
+	stripped := make([]string, 0, len(names))
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			stripped = append(stripped, name)
+		}
+	}
+	// part of the key of the pooled client
+	sort.Strings(stripped)
+	return stripped
+}
+
+// checkRedirect returns the redirect policy of a client, which can only depend
+// on its settings as the client is shared
+func checkRedirect(key clientPoolKey) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > key.maxRedirects {
+			chain := make([]string, 0, len(via)+1)
+			for _, r := range via {
+				chain = append(chain, r.URL.Redacted())
+			}
+			chain = append(chain, req.URL.Redacted())
+			return redirectError{fmt.Errorf("stopped after max_redirects %d redirects: %s", key.maxRedirects, strings.Join(chain, " -> "))}
+		}
+		// only 307 and 308 keep the body, and only when it can be read again
+		if !key.resendBodyOnRedirect && req.Body != nil && req.Body != http.NoBody {
+			return redirectError{fmt.Errorf("refusing redirect to %s, resend_body_on_redirect is false and it would send the request body again", req.URL.Redacted())}
+		}
+		if key.httpsOnlyRedirects && req.URL.Scheme != "https" {
+			return redirectError{fmt.Errorf("refusing redirect to %s, https_only_redirects only allows https", req.URL.Redacted())}
+		}
+		if !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+			if key.restrictRedirectHost {
+				return redirectError{fmt.Errorf("refusing redirect to host %q, restrict_redirect_host only allows %q", req.URL.Hostname(), via[0].URL.Hostname())}
+			}
+			// the default policy keeps credentials for subdomains and only knows a few headers
+			for _, name := range strings.Split(key.redirectStripHeaders, ",") {
+				req.Header.Del(name)
+			}
+		}
+		return nil
+	}
+}
+
+// setSHA256Trailer sends the body chunked, as trailers require, and sets the
+// trailer name to the hex SHA-256 of the body once it is fully read. The body
+// cannot be resent with its trailer so 307 and 308 redirects are not followed.
+func setSHA256Trailer(req *http.Request, name string) {
+	name = http.CanonicalHeaderKey(name)
+	// announced in the Trailer header, the value is filled in at EOF
+	req.Trailer = http.Header{name: nil}
+	req.ContentLength = -1
+	req.GetBody = nil
+	req.Body = &sha256TrailerBody{ReadCloser: req.Body, trailer: req.Trailer, name: name, hash: sha256.New()}
+}
+
+type sha256TrailerBody struct {
+	io.ReadCloser
+	trailer http.Header
+	name    string
+	hash    hash.Hash
+}
+
+func (b *sha256TrailerBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF {
+		b.trailer.Set(b.name, hex.EncodeToString(b.hash.Sum(nil)))
+	}
+	return n, err
+}
+
+// readErrorBody remembers the first error reading the request body other than
+// io.EOF, which the transport does not return
+type readErrorBody struct {
+	io.Reader
+	mu  sync.Mutex
+	err error
+}
+
+func (b *readErrorBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		b.mu.Lock()
+		if b.err == nil {
+			b.err = err
+		}
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+func (b *readErrorBody) error() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
 
-func dataSourceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
-	url := d.Get("url").(string)
-	headers := d.Get("request_headers").(map[string]interface{})
+// isSetInConfig reports whether key is set in the configuration, unlike
+// GetOk this is true for an explicit zero value such as false
+func isSetInConfig(d *schema.ResourceData, key string) bool {
+	raw := d.GetRawConfig()
+	if raw.IsNull() || !raw.IsKnown() {
+		_, ok := d.GetOk(key)
+		return ok
+	}
+	return !raw.GetAttr(key).IsNull()
+}
 
-	var skip_verify bool
-	skip_verify_override, ok := d.GetOk("insecure_skip_verify")
-	if ok {
-		if skip_verify, ok = skip_verify_override.(bool); !ok {
-			return append(diags, diag.Errorf("Error overriding skip_verify_override")...)
+// dataSourceDisabled sets empty results without making a request
+func dataSourceDisabled(d *schema.ResourceData, url string) (diags diag.Diagnostics) {
+	for k, v := range map[string]interface{}{
+		"status_code":      0,
+		"response_body":    "",
+		"body":             "",
+		"response_headers": map[string]string{},
+	} {
+		if err := d.Set(k, v); err != nil {
+			return append(diags, diag.Errorf("Error setting %s: %s", k, err)...)
 		}
 	}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: skip_verify,
+	if url == "" {
+		url = "disabled"
 	}
+	d.SetId(url)
 
-	sni, ok := d.GetOk("sni")
-	if ok {
-		tlsConfig.ServerName = sni.(string)
+	return diags
+}
+
+// cookieDetails flattens the attributes of cookies for response_cookies_detail,
+// expires is RFC 3339 in UTC and empty when the cookie has no Expires
+func cookieDetails(cookies []*http.Cookie) []map[string]interface{} {
+	var details []map[string]interface{}
+	for _, c := range cookies {
+		expires := ""
+		if !c.Expires.IsZero() {
+			expires = c.Expires.UTC().Format(time.RFC3339)
+		}
+		sameSite := ""
+		switch c.SameSite {
+		case http.SameSiteLaxMode:
+			sameSite = "Lax"
+		case http.SameSiteStrictMode:
+			sameSite = "Strict"
+		case http.SameSiteNoneMode:
+			sameSite = "None"
+		}
+		details = append(details, map[string]interface{}{
+			"name":      c.Name,
+			"value":     c.Value,
+			"domain":    c.Domain,
+			"path":      c.Path,
+			"expires":   expires,
+			"secure":    c.Secure,
+			"http_only": c.HttpOnly,
+			"same_site": sameSite,
+		})
 	}
+	return details
+}
 
-	castr, ok := d.GetOk("ca")
-	if ok {
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM([]byte(castr.(string)))
-		tlsConfig.RootCAs = caCertPool
+// This is to prevent potential issues w/ binary files
+// and generally unprintable characters
+// See https://github.com/hashicorp/terraform/pull/3858#issuecomment-156856738
+func isContentTypeText(contentType string) bool {
+
+	parsedType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
 	}
 
-	client_crt, ok := d.GetOk("client_crt")
-	if ok {
-		client_key, ok := d.GetOk("client_key")
-		if !ok {
-			return append(diags, diag.Errorf("Both client_crt and client_key must be specified")...)
+	allowedContentTypes := []*regexp.Regexp{
+		regexp.MustCompile("^text/.+"),
+		regexp.MustCompile("^application/json$"),
+		regexp.MustCompile("^application/(x-)?ndjson$"),
+		regexp.MustCompile("^application/samlmetadata\\+xml"),
+	}
+
+	for _, r := range allowedContentTypes {
+		if r.MatchString(parsedType) {
+			charset := strings.ToLower(params["charset"])
+			if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+				return true
+			}
+			// anything else is transcoded to UTF-8 if we know how to
+			_, err := htmlindex.Get(charset)
+			return err == nil
 		}
-		clientCerts, err := tls.X509KeyPair(
-			[]byte(client_crt.(string)),
-			[]byte(client_key.(string)),
-		)
-		if err != nil {
-			return append(diags, diag.Errorf("Error loading client certificates: %s", err)...)
+	}
+
+	return false
+}
+
+// redactURL hides the password of rawURL, if any
+func redactURL(rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+// redactHeaders flattens h, replacing the value of sensitive headers
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string)
+	for k, v := range h {
+		out[k] = strings.Join(v, ", ")
+	}
+	for _, name := range sensitiveHeaders {
+		if _, ok := out[http.CanonicalHeaderKey(name)]; ok {
+			out[http.CanonicalHeaderKey(name)] = redacted
 		}
-		tlsConfig.Certificates = []tls.Certificate{clientCerts}
 	}
+	return out
+}
+
+// renderRequest serializes req for dry_run
+func renderRequest(req *http.Request, body string) (string, error) {
+	b, err := json.MarshalIndent(struct {
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		Body    string            `json:"body"`
+	}{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: redactHeaders(req.Header),
+		Body:    body,
+	}, "", "  ")
+	return string(b), err
+}
+
+// hashSensitiveValue is used as a StateFunc so secrets are only kept hashed in state
+func hashSensitiveValue(v interface{}) string {
+	sum := sha256.Sum256([]byte(v.(string)))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeFingerprint accepts both plain and colon separated hex, in any case
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+}
 
-	tr := &http.Transport{
-		TLSClientConfig: tlsConfig,
-		Proxy:           http.ProxyFromEnvironment,
+// checkCertValidity returns an error if cert expires within days
+func checkCertValidity(cert *x509.Certificate, days int) error {
+	remaining := time.Until(cert.NotAfter)
+	if remaining < time.Duration(days)*24*time.Hour {
+		return fmt.Errorf("certificate %q expires at %s (%d days), less than min_cert_validity_days %d",
+			cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339), int(remaining.Hours()/24), days)
 	}
-	client := &http.Client{Transport: tr}
+	return nil
+}
 
-	verb := http.MethodGet
+// interfaceAddr returns the address of the named network interface to
+// connect from, its first IPv4 address or else its first global IPv6 one, as
+// link-local IPv6 addresses only reach the local link
+func interfaceAddr(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	var ipv6 net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			return ip4, nil
+		}
+		if ipv6 == nil && !ipNet.IP.IsLinkLocalUnicast() {
+			ipv6 = ipNet.IP
+		}
+	}
+	if ipv6 == nil {
+		return nil, fmt.Errorf("%s has no IPv4 or global IPv6 address", name)
+	}
+	return ipv6, nil
+}
 
-	method_override, ok := d.GetOk("method")
-	if ok {
-		if verb, ok = method_override.(string); !ok {
-			return append(diags, diag.Errorf("Error overriding verb")...)
+// getPEM returns the PEM of the name attribute, or else that of name_base64
+// decoded, which avoids escaping its newlines when passed through variables
+func getPEM(d *schema.ResourceData, name string) (string, bool, error) {
+	if v, ok := d.GetOk(name + "_base64"); ok {
+		pem, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v.(string)))
+		if err != nil {
+			return "", false, err
 		}
+		return string(pem), true, nil
 	}
+	v, ok := d.GetOk(name)
+	if !ok {
+		return "", false, nil
+	}
+	return v.(string), true, nil
+}
 
-	var body io.Reader
-	b, ok := d.GetOk("request_body")
-	if ok {
-		verb = http.MethodPost
-		if method_override != nil {
-			if verb, ok = method_override.(string); !ok {
-				return append(diags, diag.Errorf("Error overriding verb")...)
+// checkCertIdentity returns an error unless cert has the common name cn and
+// the subject alternative name san, either may be empty to not check it
+func checkCertIdentity(cert *x509.Certificate, cn, san string) error {
+	if cn != "" && cert.Subject.CommonName != cn {
+		return fmt.Errorf("server certificate common name %q is not expected_cert_cn %q", cert.Subject.CommonName, cn)
+	}
+	if san == "" {
+		return nil
+	}
+	for _, name := range cert.DNSNames {
+		if strings.EqualFold(name, san) {
+			return nil
+		}
+	}
+	if ip := net.ParseIP(san); ip != nil {
+		for _, certIP := range cert.IPAddresses {
+			if certIP.Equal(ip) {
+				return nil
 			}
 		}
-		body = bytes.NewReader([]byte(b.(string)))
 	}
+	for _, uri := range cert.URIs {
+		if uri.String() == san {
+			return nil
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if strings.EqualFold(email, san) {
+			return nil
+		}
+	}
+	return fmt.Errorf("expected_cert_san %q is not a subject alternative name of the server certificate", san)
+}
 
-	req, err := http.NewRequestWithContext(ctx, verb, url, body)
-	if err != nil {
-		return append(diags, diag.Errorf("Error creating request: %s", err)...)
+// parseCertificatePEM parses the first CERTIFICATE block of s
+func parseCertificatePEM(s string) (*x509.Certificate, error) {
+	rest := []byte(s)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			return nil, fmt.Errorf("no CERTIFICATE PEM block found")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
 	}
+}
 
-	for name, value := range headers {
-		req.Header.Set(name, value.(string))
+// checkChainsToIssuer returns an error unless the leaf of certs chains to
+// issuer, using the other certificates sent by the server as intermediates.
+// The hostname is left to the usual verification.
+func checkChainsToIssuer(certs []*x509.Certificate, issuer *x509.Certificate) error {
+	if len(certs) == 0 {
+		return fmt.Errorf("no server certificate to verify against pinned_issuer")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(issuer)
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
 	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		return fmt.Errorf("server certificate does not chain to pinned_issuer %q: %s", issuer.Subject.String(), err)
+	}
+	return nil
+}
 
-	timeout_override, ok := d.GetOk("request_timeout_ms")
-	if ok {
-		var timeout int
-		if timeout, ok = timeout_override.(int); !ok {
-			return append(diags, diag.Errorf("Error overriding request_timeout_ms")...)
+// appendCertsFromDir adds every *.pem and *.crt file in dir to pool, and
+// writes their contents to w
+func appendCertsFromDir(pool *x509.CertPool, dir string, w io.Writer) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".pem" && ext != ".crt") {
+			continue
 		}
-		client.Timeout = time.Duration(timeout) * time.Millisecond
+		pemData, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return fmt.Errorf("no certificates found in %s", e.Name())
+		}
+		w.Write(pemData)
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("no *.pem or *.crt files found in %s", dir)
 	}
+	return nil
+}
 
-	resp, err := client.Do(req)
+// validateJSONSchema validates body against the provided JSON Schema and
+// returns one diagnostic per violation found
+func validateJSONSchema(schemaStr string, body []byte) (diags diag.Diagnostics) {
+	sch, err := jsonschema.CompileString("response_json_schema.json", schemaStr)
 	if err != nil {
-		return append(diags, diag.Errorf("Error making request: %s", err)...)
+		return append(diags, diag.Errorf("Error compiling response_json_schema: %s", err)...)
 	}
 
-	defer resp.Body.Close()
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return append(diags, diag.Errorf("Error parsing response body as JSON: %s", err)...)
+	}
 
-	// TODO, check if the response code is valid for the verb sent in...
+	err = sch.Validate(v)
+	if err == nil {
+		return diags
+	}
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return append(diags, diag.Errorf("Error validating response body: %s", err)...)
+	}
 
-	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+	var collect func(*jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  "Response body does not match response_json_schema",
+				Detail:   fmt.Sprintf("%q: %s (schema %s)", e.InstanceLocation, e.Message, e.KeywordLocation),
+			})
+			return
+		}
+		for _, c := range e.Causes {
+			collect(c)
+		}
+	}
+	collect(ve)
 
-		bytes, err := ioutil.ReadAll(resp.Body)
+	return diags
+}
+
+// decodeContentEncoding returns a reader decoding the response body if the
+// transport did not already do so (eg, when accept_encoding is set)
+func decodeContentEncoding(resp *http.Response) (io.Reader, error) {
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(resp.Body)
 		if err != nil {
-			return append(diags, diag.Errorf("HTTP request error. Response code: %d", resp.StatusCode)...)
+			return nil, err
 		}
-		return append(diags, diag.Errorf("HTTP request error. Response code: %d,  Error Response body: %s", resp.StatusCode, string(bytes))...)
+		r = gz
+	case "deflate":
+		// per RFC 9110 deflate is the zlib format
+		zr, err := zlib.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(resp.Body)
+	case "zstd":
+		// decodes synchronously, without goroutines that would need a Close
+		zr, err := zstd.NewReader(resp.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	default:
+		return resp.Body, nil
 	}
 
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" || isContentTypeText(contentType) == false {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Warning,
-			Summary:  fmt.Sprintf("Content-Type is not recognized as a text type, got %q", contentType),
-			Detail:   "If the content is binary data, Terraform may not properly handle the contents of the response.",
+	// as done by the transport for gzip
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+
+	return r, nil
+}
+
+// bodyFileDir is the directory under the system temporary directory that
+// body_file paths are in
+const bodyFileDir = "terraform-provider-http-full"
+
+// writeBodyFile writes body to a file named after url and body, and returns
+// its path. Reading the same body again rewrites the same file, so neither
+// files pile up nor body_file changes from one read to the next.
+func writeBodyFile(url string, body []byte) (string, error) {
+	dir := filepath.Join(os.TempDir(), bodyFileDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(url))
+	h.Write([]byte{0})
+	h.Write(body)
+	path := filepath.Join(dir, hex.EncodeToString(h.Sum(nil)))
+
+	// written aside and renamed, a concurrent read of the same body never
+	// sees a partial file
+	f, err := ioutil.TempFile(dir, ".body-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return path, nil
+}
+
+// readNDJSON reads a newline delimited JSON stream line by line. If the
+// request times out mid-stream, what was read so far is returned with
+// timedOut set rather than an error.
+func readNDJSON(r io.Reader) (body []byte, objects []string, timedOut bool, err error) {
+	br := bufio.NewReader(r)
+	for lineNo := 1; ; lineNo++ {
+		line, readErr := br.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			var netErr net.Error
+			if errors.Is(readErr, context.DeadlineExceeded) || (errors.As(readErr, &netErr) && netErr.Timeout()) {
+				// a partial last line is dropped
+				return body, objects, true, nil
+			}
+			return nil, nil, false, readErr
+		}
+		body = append(body, line...)
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			if !json.Valid(trimmed) {
+				return nil, nil, false, fmt.Errorf("line %d is not valid JSON", lineNo)
+			}
+			objects = append(objects, string(trimmed))
+		}
+
+		if readErr == io.EOF {
+			return body, objects, false, nil
+		}
+	}
+}
+
+// splitLines splits s on LF or CRLF, a trailing newline does not add an empty line
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// parseMultipartBody splits a multipart body into its parts' headers and body
+func parseMultipartBody(body []byte, boundary string) ([]map[string]interface{}, error) {
+	if boundary == "" {
+		return nil, fmt.Errorf("no boundary in Content-Type")
+	}
+
+	parts := []map[string]interface{}{}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		partBody, err := ioutil.ReadAll(p)
+		if err != nil {
+			return nil, err
+		}
+		headers := make(map[string]string)
+		for k, v := range p.Header {
+			headers[k] = strings.Join(v, ", ")
+		}
+		parts = append(parts, map[string]interface{}{
+			"headers": headers,
+			"body":    string(partBody),
 		})
 	}
+}
 
-	bytes, err := ioutil.ReadAll(resp.Body)
+// decodeBOM transcodes a body starting with a UTF-8 or UTF-16 byte order mark
+// to UTF-8, without the mark. It reports false for a body without one.
+func decodeBOM(body []byte) ([]byte, bool) {
+	var enc encoding.Encoding
+	switch {
+	case bytes.HasPrefix(body, []byte{0xef, 0xbb, 0xbf}):
+		return body[3:], true
+	case bytes.HasPrefix(body, []byte{0xfe, 0xff}):
+		enc = unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(body, []byte{0xff, 0xfe}):
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	default:
+		return body, false
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
 	if err != nil {
-		return append(diags, diag.FromErr(err)...)
+		return body, false
 	}
+	return decoded, true
+}
 
-	responseHeaders := make(map[string]string)
-	for k, v := range resp.Header {
-		// Concatenate according to RFC2616
-		// cf. https://www.w3.org/Protocols/rfc2616/rfc2616-sec4.html#sec4.2
-		responseHeaders[k] = strings.Join(v, ", ")
+// decodeCharset transcodes body from charset to UTF-8
+func decodeCharset(body []byte, charset string) ([]byte, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return body, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
 	}
+	return enc.NewDecoder().Bytes(body)
+}
 
-	if err = d.Set("status_code", resp.StatusCode); err != nil {
-		return append(diags, diag.Errorf("Error setting HTTP status_code: %s", err)...)
+// truncatingReader reads the first n bytes of r, as io.LimitReader, and
+// records whether r had more by reading a single byte past them
+type truncatingReader struct {
+	r         io.Reader
+	n         int64
+	truncated bool
+}
+
+func (t *truncatingReader) Read(p []byte) (int, error) {
+	if t.n <= 0 {
+		if !t.truncated {
+			var b [1]byte
+			n, _ := io.ReadFull(t.r, b[:])
+			t.truncated = n > 0
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > t.n {
+		p = p[:t.n]
 	}
+	n, err := t.r.Read(p)
+	t.n -= int64(n)
+	return n, err
+}
 
-	if err = d.Set("response_body", string(bytes)); err != nil {
-		return append(diags, diag.Errorf("Error setting HTTP response body: %s", err)...)
+// downloadTimeoutBody cancels the request once the response body has been
+// downloading for timeoutMs, however fast the bytes are still arriving
+type downloadTimeoutBody struct {
+	io.ReadCloser
+	timeoutMs int
+	timer     *time.Timer
+	timedOut  int32
+}
+
+func newDownloadTimeoutBody(body io.ReadCloser, timeoutMs int, cancel context.CancelFunc) *downloadTimeoutBody {
+	b := &downloadTimeoutBody{ReadCloser: body, timeoutMs: timeoutMs}
+	b.timer = time.AfterFunc(time.Duration(timeoutMs)*time.Millisecond, func() {
+		atomic.StoreInt32(&b.timedOut, 1)
+		cancel()
+	})
+	return b
+}
+
+// Read reports the cancellation as a deadline so, like request_timeout_ms,
+// it ends an ndjson stream with the objects received so far
+func (b *downloadTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && atomic.LoadInt32(&b.timedOut) == 1 {
+		err = fmt.Errorf("response body download exceeded max_download_time_ms %d: %w", b.timeoutMs, context.DeadlineExceeded)
 	}
+	return n, err
+}
 
-	if err = d.Set("response_headers", responseHeaders); err != nil {
-		return append(diags, diag.Errorf("Error setting HTTP response headers: %s", err)...)
+func (b *downloadTimeoutBody) stop() {
+	b.timer.Stop()
+}
+
+// isRedirectStatus reports whether code is one of the redirects the client
+// follows to their Location
+func isRedirectStatus(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently,
+		http.StatusFound,
+		http.StatusSeeOther,
+		http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect:
+		return true
 	}
+	return false
+}
 
-	if err = d.Set("body", string(bytes)); err != nil {
-		return append(diags, diag.Errorf("Error setting HTTP response body: %s", err)...)
+// redirectError is a redirect refused by checkRedirect, which sending the
+// request again would not change
+type redirectError struct {
+	error
+}
+
+// shouldRetry reports whether a request ending with resp or err may succeed
+// if sent again
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		var refused redirectError
+		// cancelled by the read itself, eg by write_timeout_ms
+		return !errors.Is(err, context.Canceled) && !errors.As(err, &refused)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
 	}
+	return false
+}
 
-	// set ID as something more stable than time
-	d.SetId(url)
+// maxDrainBytes is how much of an unread body drainBody reads to keep the
+// connection, a longer one is cheaper to close along with its connection
+const maxDrainBytes = 256 << 10
 
-	return diags
+// drainBody reads what is left of body, up to maxDrainBytes, and closes it so
+// the transport can reuse the connection for the next request
+func drainBody(body io.ReadCloser) {
+	io.CopyN(ioutil.Discard, body, maxDrainBytes)
+	body.Close()
 }
 
-// This is to prevent potential issues w/ binary files
-// and generally unprintable characters
-// See https://github.com/hashicorp/terraform/pull/3858#issuecomment-156856738
-func isContentTypeText(contentType string) bool {
+// bodyMatches reports whether the decoded body of resp matches re. The body is
+// read in full and replaced by a copy for the rest of the read.
+func bodyMatches(resp *http.Response, re *regexp.Regexp) (bool, error) {
+	raw, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(raw))
 
-	parsedType, params, err := mime.ParseMediaType(contentType)
+	encoded := *resp
+	encoded.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	r, err := decodeContentEncoding(&encoded)
 	if err != nil {
-		return false
+		// reported when the body is read for the response
+		return false, nil
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return false, nil
 	}
+	return re.Match(body), nil
+}
 
-	allowedContentTypes := []*regexp.Regexp{
-		regexp.MustCompile("^text/.+"),
-		regexp.MustCompile("^application/json$"),
-		regexp.MustCompile("^application/samlmetadata\\+xml"),
+// retryBackoff is wait doubled for each of the retries made, up to max
+func retryBackoff(wait time.Duration, retriesMade int, max time.Duration) time.Duration {
+	if wait > max {
+		return max
 	}
+	for i := 0; i < retriesMade; i++ {
+		// doubling past max would also overflow for many retries
+		if wait > max/2 {
+			return max
+		}
+		wait <<= 1
+	}
+	return wait
+}
 
-	for _, r := range allowedContentTypes {
-		if r.MatchString(parsedType) {
-			charset := strings.ToLower(params["charset"])
-			return charset == "" || charset == "utf-8" || charset == "us-ascii"
+// retryAfter is the wait requested by a Retry-After header, in seconds or as
+// an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, true
 		}
+		return 0, true
 	}
+	return 0, false
+}
 
-	return false
+// writeTimeoutBody cancels the request if the body is not fully read by the
+// transport within timeout of the first read, ie if the upload stalls
+type writeTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	cancel  context.CancelFunc
+
+	start    sync.Once
+	timer    *time.Timer
+	mu       sync.Mutex
+	done     bool
+	timedOut int32
+}
+
+func newWriteTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *writeTimeoutBody {
+	return &writeTimeoutBody{ReadCloser: body, timeout: timeout, cancel: cancel}
+}
+
+func (b *writeTimeoutBody) Read(p []byte) (int, error) {
+	b.start.Do(func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if !b.done {
+			b.timer = time.AfterFunc(b.timeout, func() {
+				atomic.StoreInt32(&b.timedOut, 1)
+				b.cancel()
+			})
+		}
+	})
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.stop()
+	}
+	return n, err
+}
+
+// Close is called by the transport once the body is written
+func (b *writeTimeoutBody) Close() error {
+	b.stop()
+	return b.ReadCloser.Close()
+}
+
+func (b *writeTimeoutBody) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+}
+
+// expired reports whether the upload was cancelled by the timeout
+func (b *writeTimeoutBody) expired() bool {
+	return atomic.LoadInt32(&b.timedOut) == 1
 }
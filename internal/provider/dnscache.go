@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsCache caches hostname resolutions across reads of one provider instance
+type dnsCache struct {
+	ttl time.Duration
+	// net.DefaultResolver.LookupIPAddr, replaced in tests
+	lookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	addrs   []net.IPAddr
+	expires time.Time
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:          ttl,
+		lookupIPAddr: net.DefaultResolver.LookupIPAddr,
+		entries:      map[string]dnsCacheEntry{},
+	}
+}
+
+// lookup returns the cached addresses of host, resolving it if missing or expired
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.lookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[host] = dnsCacheEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	return addrs, nil
+}
+
+// dialContext returns a DialContext for http.Transport connecting to the
+// cached addresses of the target host in turn
+func (c *dnsCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		addrs, err := c.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = &net.DNSError{Err: "no addresses found", Name: host}
+		}
+		return nil, lastErr
+	}
+}
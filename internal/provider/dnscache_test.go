@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDNSCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("1.0.0"))
+	}))
+	defer server.Close()
+
+	lookups := 0
+	cache := newDNSCache(100 * time.Millisecond)
+	cache.lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		lookups++
+		if host != "cached.test" {
+			t.Fatalf("unexpected lookup of %s", host)
+		}
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+
+	url := strings.Replace(server.URL, "127.0.0.1", "cached.test", 1)
+	get := func() {
+		// a new transport per request, as done by each read
+		client := &http.Client{Transport: &http.Transport{DialContext: cache.dialContext(&net.Dialer{})}}
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		resp.Body.Close()
+	}
+
+	get()
+	get()
+	if lookups != 1 {
+		t.Errorf("got %d lookups before the ttl expired; want 1", lookups)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	get()
+	if lookups != 2 {
+		t.Errorf("got %d lookups after the ttl expired; want 2", lookups)
+	}
+}
@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/itchyny/gojq"
+)
+
+// compileJQ parses and compiles a jq expression
+func compileJQ(expr string) (*gojq.Code, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return gojq.Compile(query)
+}
+
+// transformJSON runs the jq expression over the JSON body and returns every
+// result JSON encoded, one per line, like `jq -c`
+func transformJSON(expr string, body []byte) (string, error) {
+	code, err := compileJQ(expr)
+	if err != nil {
+		return "", err
+	}
+
+	var input interface{}
+	if err := json.Unmarshal(body, &input); err != nil {
+		return "", fmt.Errorf("response body is not JSON: %s", err)
+	}
+
+	var results []string
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, isErr := v.(error); isErr {
+			return "", err
+		}
+		out, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		results = append(results, string(out))
+	}
+
+	return strings.Join(results, "\n"), nil
+}
+
+func validateJQ(val interface{}, key string) (warns []string, errs []error) {
+	if v, ok := val.(string); ok {
+		if _, err := compileJQ(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s is not a valid jq expression: %s", key, err))
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("error parsing %s", key))
+	}
+	return
+}
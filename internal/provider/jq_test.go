@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestTransformJSON(t *testing.T) {
+	body := []byte(`{"name":"foo","items":[{"id":1},{"id":2}]}`)
+
+	for _, tc := range []struct {
+		expr string
+		want string
+	}{
+		{`.name`, `"foo"`},
+		{`.items | map(.id)`, `[1,2]`},
+		{`.items[].id`, "1\n2"},
+		{`{n: .name, count: (.items | length)}`, `{"count":2,"n":"foo"}`},
+		{`empty`, ``},
+	} {
+		got, err := transformJSON(tc.expr, body)
+		if err != nil {
+			t.Errorf("%s: err: %s", tc.expr, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s = %q; want %q", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestTransformJSONErrors(t *testing.T) {
+	if _, err := transformJSON(`.name`, []byte(`not json`)); err == nil {
+		t.Error("expected an error for a non JSON body")
+	}
+	if _, err := transformJSON(`.name | error("boom")`, []byte(`{"name":"foo"}`)); err == nil {
+		t.Error("expected the jq runtime error")
+	}
+	if _, errs := validateJQ(`.items[`, "jq"); len(errs) == 0 {
+		t.Error("expected a validation error")
+	}
+}
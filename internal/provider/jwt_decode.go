@@ -0,0 +1,202 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// dataSourceJWTDecode decodes the header and claims of a JWT, typically one
+// fetched by the http data source, without verifying its signature
+func dataSourceJWTDecode() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceJWTDecodeRead,
+
+		Schema: map[string]*schema.Schema{
+			"token": {
+				Description:  "The JWT to decode, with or without a `Bearer ` prefix.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Sensitive:    true,
+				ExactlyOneOf: []string{"token", "json"},
+			},
+			"json": {
+				Description:  "A JSON document, eg a token endpoint response body, holding the JWT at `json_path`.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Sensitive:    true,
+				ExactlyOneOf: []string{"token", "json"},
+				RequiredWith: []string{"json_path"},
+			},
+			"json_path": {
+				Description:  "JSONPath of the JWT in `json`, eg `$.access_token`.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				RequiredWith: []string{"json"},
+				ValidateFunc: validateJSONPath,
+			},
+			"header": {
+				Description: "The JOSE header, non-string values JSON encoded.",
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"claims": {
+				Description: "The claims, non-string values JSON encoded.",
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"claims_json": {
+				Description: "The claims as JSON, for use with `jsondecode`.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"scopes": {
+				Description: "The scopes of the space separated `scope` claim, or of the `scp` claim.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"expires_at": {
+				Description: "The `exp` claim in RFC 3339 format, empty when there is none.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"expired": {
+				Description: "Whether `exp` is in the past at the time of the read.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceJWTDecodeRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	token := d.Get("token").(string)
+	if doc, ok := d.GetOk("json"); ok {
+		var err error
+		if token, err = jsonPathString([]byte(doc.(string)), d.Get("json_path").(string)); err != nil {
+			return append(diags, diag.Errorf("Error reading json_path: %s", err)...)
+		}
+		if token == "" {
+			return append(diags, diag.Errorf("No token at json_path %s", d.Get("json_path").(string))...)
+		}
+	}
+	token = strings.TrimSpace(token)
+	if len(token) > len("bearer ") && strings.EqualFold(token[:len("bearer ")], "bearer ") {
+		token = strings.TrimSpace(token[len("bearer "):])
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return append(diags, diag.Errorf("Error decoding token: a JWT has 3 dot separated parts, got %d", len(parts))...)
+	}
+	header, _, err := decodeJWTPart(parts[0])
+	if err != nil {
+		return append(diags, diag.Errorf("Error decoding token header: %s", err)...)
+	}
+	claims, claimsJSON, err := decodeJWTPart(parts[1])
+	if err != nil {
+		return append(diags, diag.Errorf("Error decoding token claims: %s", err)...)
+	}
+
+	var expiresAt string
+	expired := false
+	if exp, ok := claims["exp"]; ok {
+		seconds, err := strconv.ParseFloat(exp, 64)
+		if err != nil {
+			return append(diags, diag.Errorf("Error decoding token claims: exp is not a number: %s", exp)...)
+		}
+		expires := time.Unix(int64(seconds), 0).UTC()
+		expiresAt = expires.Format(time.RFC3339)
+		expired = time.Now().After(expires)
+	}
+
+	if err := d.Set("header", header); err != nil {
+		return append(diags, diag.Errorf("Error setting header: %s", err)...)
+	}
+	if err := d.Set("claims", claims); err != nil {
+		return append(diags, diag.Errorf("Error setting claims: %s", err)...)
+	}
+	if err := d.Set("claims_json", claimsJSON); err != nil {
+		return append(diags, diag.Errorf("Error setting claims_json: %s", err)...)
+	}
+	if err := d.Set("scopes", jwtScopes(claims)); err != nil {
+		return append(diags, diag.Errorf("Error setting scopes: %s", err)...)
+	}
+	if err := d.Set("expires_at", expiresAt); err != nil {
+		return append(diags, diag.Errorf("Error setting expires_at: %s", err)...)
+	}
+	if err := d.Set("expired", expired); err != nil {
+		return append(diags, diag.Errorf("Error setting expired: %s", err)...)
+	}
+
+	// the token itself is a credential, keep it out of the ID
+	sum := sha256.Sum256([]byte(token))
+	d.SetId(hex.EncodeToString(sum[:]))
+
+	return diags
+}
+
+// decodeJWTPart decodes a base64url JSON object of a JWT into its members,
+// with non-string values JSON encoded, and its JSON
+func decodeJWTPart(part string) (map[string]string, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+	if err != nil {
+		return nil, "", err
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return nil, "", fmt.Errorf("not a JSON object: %s", err)
+	}
+
+	values := make(map[string]string, len(members))
+	for name, value := range members {
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			values[name] = s
+			continue
+		}
+		// numbers keep their digits, eg exp is not turned into 1.7e+09
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, value); err != nil {
+			return nil, "", err
+		}
+		values[name] = compact.String()
+	}
+	return values, string(raw), nil
+}
+
+// jwtScopes returns the scopes of the OAuth 2.0 scope claim, or of the scp
+// claim used by some issuers, either space separated or a JSON array
+func jwtScopes(claims map[string]string) []string {
+	for _, name := range []string{"scope", "scp"} {
+		value, ok := claims[name]
+		if !ok {
+			continue
+		}
+		var scopes []string
+		if err := json.Unmarshal([]byte(value), &scopes); err == nil {
+			return scopes
+		}
+		return strings.Fields(value)
+	}
+	return nil
+}
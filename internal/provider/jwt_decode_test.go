@@ -0,0 +1,148 @@
+package provider
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// testJWT is unsigned, the signature is never checked
+var testJWT = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT","kid":"k1"}`)) + "." +
+	base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"svc@example.com","aud":["api","admin"],"exp":1700000000,"scope":"read write"}`)) +
+	".c2lnbmF0dXJl"
+
+const testDataSourceConfig_jwt_decode = `
+data "http_jwt_decode" "token" {
+  token = "Bearer %s"
+}
+
+data "http_jwt_decode" "json" {
+  json      = jsonencode({ access_token = "%s", token_type = "Bearer" })
+  json_path = "$.access_token"
+}
+
+output "claims" {
+  value = data.http_jwt_decode.token.claims
+}
+
+output "kid" {
+  value = data.http_jwt_decode.token.header["kid"]
+}
+
+output "scopes" {
+  value = join(",", data.http_jwt_decode.token.scopes)
+}
+
+output "expires_at" {
+  value = "${data.http_jwt_decode.json.expires_at},${data.http_jwt_decode.json.expired}"
+}
+
+output "aud" {
+  value = join(",", jsondecode(data.http_jwt_decode.json.claims_json).aud)
+}
+`
+
+func TestDataSource_jwt_decode(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_jwt_decode, testJWT, testJWT),
+				Check: func(s *terraform.State) error {
+					outputs := s.RootModule().Outputs
+
+					want := map[string]interface{}{
+						"sub":   "svc@example.com",
+						"aud":   `["api","admin"]`,
+						"exp":   "1700000000",
+						"scope": "read write",
+					}
+					if !reflect.DeepEqual(outputs["claims"].Value, want) {
+						return fmt.Errorf("'claims' output is %v; want %v", outputs["claims"].Value, want)
+					}
+
+					if outputs["kid"].Value != "k1" {
+						return fmt.Errorf(
+							`'kid' output is %s; want 'k1'`,
+							outputs["kid"].Value,
+						)
+					}
+
+					if outputs["scopes"].Value != "read,write" {
+						return fmt.Errorf(
+							`'scopes' output is %s; want 'read,write'`,
+							outputs["scopes"].Value,
+						)
+					}
+
+					if outputs["expires_at"].Value != "2023-11-14T22:13:20Z,true" {
+						return fmt.Errorf(
+							`'expires_at' output is %s; want '2023-11-14T22:13:20Z,true'`,
+							outputs["expires_at"].Value,
+						)
+					}
+
+					if outputs["aud"].Value != "api,admin" {
+						return fmt.Errorf(
+							`'aud' output is %s; want 'api,admin'`,
+							outputs["aud"].Value,
+						)
+					}
+
+					return nil
+				},
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_jwt_decode_invalid = `
+data "http_jwt_decode" "token" {
+  token = "not-a-jwt"
+}
+`
+
+const testDataSourceConfig_jwt_decode_json_path = `
+data "http_jwt_decode" "json" {
+  json      = jsonencode({ access_token = "%s" })
+  json_path = "$..access_token"
+}
+`
+
+func TestDataSource_jwt_decode_invalid(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      testDataSourceConfig_jwt_decode_invalid,
+				ExpectError: regexp.MustCompile("a JWT has 3 dot separated parts, got 1"),
+			},
+			{
+				// rejected at plan time, as paginate.next_jsonpath is
+				Config:      fmt.Sprintf(testDataSourceConfig_jwt_decode_json_path, testJWT),
+				ExpectError: regexp.MustCompile("unsupported JSONPath"),
+			},
+		},
+	})
+}
+
+func TestJWTScopes(t *testing.T) {
+	for _, tc := range []struct {
+		claims map[string]string
+		want   []string
+	}{
+		{map[string]string{"scope": "read write"}, []string{"read", "write"}},
+		{map[string]string{"scp": `["read","write"]`}, []string{"read", "write"}},
+		{map[string]string{"scope": "openid", "scp": `["read"]`}, []string{"openid"}},
+		{map[string]string{"sub": "svc"}, nil},
+	} {
+		if got := jwtScopes(tc.claims); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("jwtScopes(%v) = %v; want %v", tc.claims, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package provider
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// keyLogFiles stay open for the life of the provider process, pooled
+// transports log the keys of every new connection after the read that opened
+// them has returned
+var (
+	keyLogMu    sync.Mutex
+	keyLogFiles = map[string]*os.File{}
+)
+
+// keyLogWriter returns the file at path, opened for appending in the NSS key
+// log format written by tls.Config.KeyLogWriter
+func keyLogWriter(path string) (io.Writer, error) {
+	keyLogMu.Lock()
+	defer keyLogMu.Unlock()
+	if f, ok := keyLogFiles[path]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	keyLogFiles[path] = f
+	return f, nil
+}
@@ -0,0 +1,230 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	defaultGCPKMSEndpoint = "https://cloudkms.googleapis.com"
+	gcpKMSScope           = "https://www.googleapis.com/auth/cloudkms"
+	kmsProviderGCP        = "gcp"
+	kmsProviderAWS        = "aws"
+)
+
+// macSigner returns the HMAC-SHA256 of message
+type macSigner func(ctx context.Context, message []byte) ([]byte, error)
+
+func localHMACSigner(key string) macSigner {
+	return func(ctx context.Context, message []byte) ([]byte, error) {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(message)
+		return mac.Sum(nil), nil
+	}
+}
+
+// kmsSignerKey identifies a pooled kmsSigner, client being the pooled client
+// of the read, and so its proxy and TLS settings
+type kmsSignerKey struct {
+	provider string
+	key      string
+	endpoint string
+	client   *http.Client
+}
+
+// kmsSigner computes the HMAC with a key held in a cloud KMS, which never
+// leaves it. Both GCP and AWS produce the same HMAC-SHA256 as a local key would.
+// The KMS is called through client, and the signer kept in pool, with its
+// credentials, for the reads with the same settings.
+func kmsSigner(settings map[string]interface{}, pool *transportPool, client *http.Client) (macSigner, error) {
+	key := kmsSignerKey{
+		provider: settings["provider"].(string),
+		key:      settings["key"].(string),
+		endpoint: strings.TrimRight(settings["endpoint"].(string), "/"),
+		client:   client,
+	}
+	return pool.signer(key, func() (macSigner, error) {
+		switch key.provider {
+		case kmsProviderGCP:
+			return gcpMacSigner(client, key.endpoint, key.key), nil
+		case kmsProviderAWS:
+			return awsMacSigner(client, key.endpoint, key.key)
+		}
+		return nil, fmt.Errorf("unknown kms_signer provider %q", key.provider)
+	})
+}
+
+func validateKMSProvider(val interface{}, key string) (warns []string, errs []error) {
+	if v, ok := val.(string); ok {
+		if v != kmsProviderGCP && v != kmsProviderAWS {
+			errs = append(errs, fmt.Errorf("%s must be gcp|aws, got: %s", key, v))
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("error parsing %s", key))
+	}
+	return
+}
+
+// gcpMacSigner calls macSign on the crypto key version, authenticating with
+// GOOGLE_OAUTH_ACCESS_TOKEN or else the application default credentials. They
+// are looked up on the first signature, dry_run never probes the metadata server.
+func gcpMacSigner(client *http.Client, endpoint, key string) macSigner {
+	if endpoint == "" {
+		endpoint = defaultGCPKMSEndpoint
+	}
+	var mu sync.Mutex
+	var authorized *http.Client
+	return func(ctx context.Context, message []byte) ([]byte, error) {
+		mu.Lock()
+		if authorized == nil {
+			tokens, err := gcpTokenSource(client)
+			if err != nil {
+				mu.Unlock()
+				return nil, fmt.Errorf("error getting GCP credentials: %s", err)
+			}
+			authorized = &http.Client{
+				Transport: &oauth2.Transport{Source: tokens, Base: client.Transport},
+				Timeout:   client.Timeout,
+			}
+		}
+		c := authorized
+		mu.Unlock()
+
+		reqBody, err := json.Marshal(map[string]string{"data": base64.StdEncoding.EncodeToString(message)})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v1/"+strings.Trim(key, "/")+":macSign", bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		var resp struct {
+			Mac string `json:"mac"`
+		}
+		if err := doKMSRequest(c, req, &resp); err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(resp.Mac)
+	}
+}
+
+// gcpTokenSource is GOOGLE_OAUTH_ACCESS_TOKEN, else the application default
+// credentials: GOOGLE_APPLICATION_CREDENTIALS, the gcloud credentials, service
+// account impersonation and workload identity federation included, then the
+// metadata server. Tokens are fetched through client.
+func gcpTokenSource(client *http.Client) (oauth2.TokenSource, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), nil
+	}
+	// kept by the token source to refresh tokens after this read
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+	creds, err := google.FindDefaultCredentials(ctx, gcpKMSScope)
+	if err != nil {
+		return nil, err
+	}
+	return creds.TokenSource, nil
+}
+
+// awsMacSigner calls GenerateMac with the credentials and region of the AWS
+// SDK default chain: the environment, the shared config and credentials files
+// and their profiles, web identity, SSO, then the container and EC2 roles. The
+// region of a key ARN takes precedence.
+func awsMacSigner(client *http.Client, endpoint, key string) (macSigner, error) {
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithHTTPClient(awsHTTPClient(client))}
+	if region := awsRegion(key); region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the AWS config: %s", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("the AWS region is neither in the key ARN nor in the AWS config")
+	}
+	kmsClient := kms.NewFromConfig(cfg, func(o *kms.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
+	return func(ctx context.Context, message []byte) ([]byte, error) {
+		resp, err := kmsClient.GenerateMac(ctx, &kms.GenerateMacInput{
+			KeyId:        aws.String(key),
+			Message:      message,
+			MacAlgorithm: types.MacAlgorithmSpecHmacSha256,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return resp.Mac, nil
+	}, nil
+}
+
+// awsHTTPClient has the proxy, dialers and TLS settings of the transport of
+// client. The SDK only adds AWS_CA_BUNDLE to the root CAs of its own client.
+func awsHTTPClient(client *http.Client) aws.HTTPClient {
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	base, ok := transport.(*http.Transport)
+	if !ok {
+		return client
+	}
+	return awshttp.NewBuildableClient().WithTimeout(client.Timeout).WithTransportOptions(func(tr *http.Transport) {
+		tr.Proxy = base.Proxy
+		tr.ProxyConnectHeader = base.ProxyConnectHeader
+		tr.DialContext = base.DialContext
+		tr.DialTLSContext = base.DialTLSContext
+		if base.TLSClientConfig != nil {
+			tr.TLSClientConfig = base.TLSClientConfig.Clone()
+		}
+		tr.ForceAttemptHTTP2 = base.ForceAttemptHTTP2
+	})
+}
+
+// awsRegion is the region of a key ARN, eg arn:aws:kms:us-east-1:111122223333:key/...,
+// empty for a key ID or alias
+func awsRegion(key string) string {
+	if parts := strings.Split(key, ":"); len(parts) > 3 && parts[0] == "arn" {
+		return parts[3]
+	}
+	return ""
+}
+
+func doKMSRequest(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// a KMS holding the HMAC key "secret", answering both the GCP and AWS APIs,
+// and the OAuth token endpoint of the GCP credentials
+func setUpMockKMS() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.FormValue("refresh_token") != "1//refresh" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "ya29.test", "token_type": "Bearer", "expires_in": 3600})
+			return
+		}
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte("secret"))
+		switch {
+		case r.URL.Path == "/v1/projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1:macSign":
+			if r.Header.Get("Authorization") != "Bearer ya29.test" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			data, _ := base64.StdEncoding.DecodeString(req["data"])
+			mac.Write(data)
+			json.NewEncoder(w).Encode(map[string]string{"mac": base64.StdEncoding.EncodeToString(mac.Sum(nil))})
+		case r.Header.Get("X-Amz-Target") == "TrentService.GenerateMac":
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || req["MacAlgorithm"] != "HMAC_SHA_256" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			data, _ := base64.StdEncoding.DecodeString(req["Message"])
+			mac.Write(data)
+			json.NewEncoder(w).Encode(map[string]string{"Mac": base64.StdEncoding.EncodeToString(mac.Sum(nil))})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// the credentials come from files, as they would from gcloud or the AWS CLI
+func TestKMSSigner(t *testing.T) {
+	server := setUpMockKMS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	adc := filepath.Join(dir, "application_default_credentials.json")
+	ioutil.WriteFile(adc, []byte(`{"type": "authorized_user", "client_id": "id", "client_secret": "secret", "refresh_token": "1//refresh", "token_uri": "`+server.URL+`/token"}`), 0600)
+	awsCredentials := filepath.Join(dir, "credentials")
+	ioutil.WriteFile(awsCredentials, []byte("[signer]\naws_access_key_id = AKIDEXAMPLE\naws_secret_access_key = wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY\n"), 0600)
+
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", adc)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", awsCredentials)
+	t.Setenv("AWS_PROFILE", "signer")
+
+	want, _ := localHMACSigner("secret")(context.Background(), []byte("message"))
+
+	// stands for the pooled client of the read, its proxy is looked up for every request
+	var requests int32
+	client := &http.Client{Transport: &http.Transport{
+		Proxy: func(*http.Request) (*neturl.URL, error) {
+			atomic.AddInt32(&requests, 1)
+			return nil, nil
+		},
+	}}
+	pool := newTransportPool(0)
+	for _, settings := range []map[string]interface{}{
+		{"provider": "gcp", "key": "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1", "endpoint": server.URL},
+		{"provider": "aws", "key": "arn:aws:kms:us-east-1:111122223333:key/1234abcd", "endpoint": server.URL},
+	} {
+		// the second read reuses the signer
+		for i := 0; i < 2; i++ {
+			sign, err := kmsSigner(settings, pool, client)
+			if err != nil {
+				t.Fatalf("%s: err: %s", settings["provider"], err)
+			}
+			got, err := sign(context.Background(), []byte("message"))
+			if err != nil {
+				t.Errorf("%s: err: %s", settings["provider"], err)
+				continue
+			}
+			if !hmac.Equal(got, want) {
+				t.Errorf("%s: got mac %x, want %x", settings["provider"], got, want)
+			}
+		}
+	}
+	if len(pool.signers) != 2 {
+		t.Errorf("pool has %d signers, want 2", len(pool.signers))
+	}
+	// a single token request, then two macSign and two GenerateMac
+	if got := atomic.LoadInt32(&requests); got != 5 {
+		t.Errorf("%d requests went through the client, want 5", got)
+	}
+}
+
+func TestKMSSignerAWSRegion(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+
+	settings := map[string]interface{}{"provider": "aws", "key": "alias/my-key", "endpoint": ""}
+	if _, err := kmsSigner(settings, nil, http.DefaultClient); err == nil {
+		t.Error("expected an error without a region")
+	}
+	t.Setenv("AWS_REGION", "eu-west-1")
+	if _, err := kmsSigner(settings, nil, http.DefaultClient); err != nil {
+		t.Errorf("err: %s", err)
+	}
+}
+
+func TestAWSRegion(t *testing.T) {
+	if got := awsRegion("arn:aws:kms:us-east-1:111122223333:key/1234abcd"); got != "us-east-1" {
+		t.Errorf("region of an ARN is %q, want us-east-1", got)
+	}
+	if got := awsRegion("alias/my-key"); got != "" {
+		t.Errorf("region of an alias is %q, want none", got)
+	}
+}
@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+)
+
+// nonceSigner returns the signer of the request_nonce block, with hmac_key or
+// kms_signer, nil if neither is set. A kms_signer is pooled in pool and calls
+// the KMS through client.
+func nonceSigner(settings map[string]interface{}, pool *transportPool, client *http.Client) (macSigner, error) {
+	key := settings["hmac_key"].(string)
+	kms := settings["kms_signer"].([]interface{})
+	if key != "" && len(kms) > 0 {
+		return nil, fmt.Errorf("only one of hmac_key and kms_signer can be set")
+	}
+	if key != "" {
+		return localHMACSigner(key), nil
+	}
+	if len(kms) > 0 {
+		return kmsSigner(kms[0].(map[string]interface{}), pool, client)
+	}
+	return nil, nil
+}
+
+// setNonceHeaders adds the timestamp and nonce headers configured in the
+// request_nonce block to req and, if sign is not nil, a signature of
+//
+//	timestamp \n nonce \n method \n request URI \n body
+//
+// computed with HMAC-SHA256 and hex encoded.
+func setNonceHeaders(ctx context.Context, req *http.Request, settings map[string]interface{}, body string, sign macSigner) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(settings["timestamp_header"].(string), timestamp)
+	req.Header.Set(settings["nonce_header"].(string), nonce)
+
+	if sign == nil {
+		return nil
+	}
+
+	mac, err := sign(ctx, []byte(strings.Join([]string{
+		timestamp,
+		nonce,
+		req.Method,
+		req.URL.RequestURI(),
+		body,
+	}, "\n")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(settings["signature_header"].(string), hex.EncodeToString(mac))
+
+	return nil
+}
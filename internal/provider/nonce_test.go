@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSetNonceHeaders(t *testing.T) {
+	settings := map[string]interface{}{
+		"timestamp_header": "X-Timestamp",
+		"nonce_header":     "X-Nonce",
+		"hmac_key":         "",
+		"signature_header": "X-Signature",
+		"kms_signer":       []interface{}{},
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/orders?id=1", nil)
+	sign, err := nonceSigner(settings, nil, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := setNonceHeaders(context.Background(), req, settings, `{"foo":"bar"}`, sign); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ts, err := strconv.ParseInt(req.Header.Get("X-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		t.Errorf("X-Timestamp is %q; want the current Unix time", req.Header.Get("X-Timestamp"))
+	}
+	nonce := req.Header.Get("X-Nonce")
+	if len(nonce) != 36 {
+		t.Errorf("X-Nonce is %q; want a UUID", nonce)
+	}
+	if req.Header.Get("X-Signature") != "" {
+		t.Errorf("X-Signature is set without hmac_key")
+	}
+
+	// a new nonce for every request
+	if err := setNonceHeaders(context.Background(), req, settings, `{"foo":"bar"}`, sign); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if req.Header.Get("X-Nonce") == nonce {
+		t.Errorf("X-Nonce was reused")
+	}
+
+	settings["hmac_key"] = "secret"
+	settings["signature_header"] = "X-Sig"
+	sign, err = nonceSigner(settings, nil, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := setNonceHeaders(context.Background(), req, settings, `{"foo":"bar"}`, sign); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(req.Header.Get("X-Timestamp") + "\n" + req.Header.Get("X-Nonce") + "\nPOST\n/orders?id=1\n" + `{"foo":"bar"}`))
+	if want := hex.EncodeToString(mac.Sum(nil)); req.Header.Get("X-Sig") != want {
+		t.Errorf("X-Sig is %q; want %q", req.Header.Get("X-Sig"), want)
+	}
+}
+
+func TestNonceSignerExclusive(t *testing.T) {
+	_, err := nonceSigner(map[string]interface{}{
+		"hmac_key": "secret",
+		"kms_signer": []interface{}{map[string]interface{}{
+			"provider": "gcp",
+			"key":      "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1",
+			"endpoint": "",
+		}},
+	}, nil, http.DefaultClient)
+	if err == nil {
+		t.Error("expected an error with both hmac_key and kms_signer")
+	}
+}
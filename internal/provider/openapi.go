@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// loadOpenAPIOperation loads the OpenAPI 3 document of specFile, and the
+// files it references, and returns its operation operationID
+func loadOpenAPIOperation(ctx context.Context, specFile, operationID string) (*routers.Route, error) {
+	loader := openapi3.NewLoader()
+	loader.Context = ctx
+	loader.IsExternalRefsAllowed = true
+	doc, err := loader.LoadFromFile(specFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %s", err)
+	}
+
+	for path, item := range doc.Paths.Map() {
+		for method, op := range item.Operations() {
+			if op.OperationID == operationID {
+				return &routers.Route{Spec: doc, Path: path, PathItem: item, Method: method, Operation: op}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no operation %q in %s", operationID, specFile)
+}
+
+// validateOpenAPI validates the status, headers and body of resp against the
+// responses of an operation of an OpenAPI 3 document and returns one
+// diagnostic per violation found
+func validateOpenAPI(ctx context.Context, specFile, operationID string, resp *http.Response, body []byte) (diags diag.Diagnostics) {
+	route, err := loadOpenAPIOperation(ctx, specFile, operationID)
+	if err != nil {
+		return append(diags, diag.Errorf("Error loading validate_against_openapi: %s", err)...)
+	}
+
+	header := resp.Header.Clone()
+	// body is already decoded
+	header.Del("Content-Encoding")
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request: resp.Request,
+			Route:   route,
+		},
+		Status: resp.StatusCode,
+		Header: header,
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+			MultiError:            true,
+		},
+	}
+	input.SetBodyBytes(body)
+
+	err = openapi3filter.ValidateResponse(ctx, input)
+	if err == nil {
+		return diags
+	}
+
+	var collect func(prefix string, err error)
+	collect = func(prefix string, err error) {
+		switch e := err.(type) {
+		case openapi3.MultiError:
+			for _, err := range e {
+				collect(prefix, err)
+			}
+		case *openapi3filter.ResponseError:
+			if e.Err == nil {
+				collect(prefix, fmt.Errorf("%s, response code %d", e.Reason, resp.StatusCode))
+				return
+			}
+			collect(e.Reason, e.Err)
+		case *openapi3.SchemaError:
+			detail := fmt.Sprintf("%q: %s", "/"+strings.Join(e.JSONPointer(), "/"), e.Reason)
+			if prefix != "" {
+				detail = prefix + ": " + detail
+			}
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  "Response does not match validate_against_openapi",
+				Detail:   detail,
+			})
+		default:
+			detail := err.Error()
+			if prefix != "" {
+				detail = prefix + ": " + detail
+			}
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  "Response does not match validate_against_openapi",
+				Detail:   detail,
+			})
+		}
+	}
+	collect("", err)
+
+	return diags
+}
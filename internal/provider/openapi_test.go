@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testOpenAPISpec = `
+openapi: 3.0.3
+info:
+  title: releases
+  version: "1"
+paths:
+  /envelope:
+    get:
+      operationId: getRelease
+      responses:
+        "200":
+          description: the release
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [data, meta]
+                properties:
+                  data:
+                    type: object
+                    required: [version]
+                    properties:
+                      version:
+                        type: string
+                        pattern: '^\d+\.\d+\.\d+$'
+                  meta:
+                    type: object
+                    properties:
+                      page:
+                        type: integer
+`
+
+func writeOpenAPISpec(t *testing.T) string {
+	t.Helper()
+	specFile := filepath.Join(t.TempDir(), "openapi.yaml")
+	if err := ioutil.WriteFile(specFile, []byte(testOpenAPISpec), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return specFile
+}
+
+func TestValidateOpenAPI(t *testing.T) {
+	specFile := writeOpenAPISpec(t)
+
+	response := func(status int) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.example.com/envelope", nil)
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Request:    req,
+		}
+	}
+
+	for _, tc := range []struct {
+		name        string
+		status      int
+		body        string
+		operationID string
+		want        []string
+	}{
+		{"valid", 200, `{"data": {"version": "1.0.0"}, "meta": {"page": 1}}`, "getRelease", nil},
+		{"violations", 200, `{"data": {"version": "latest"}, "meta": {"page": "one"}}`, "getRelease", []string{`"/data/version"`, `"/meta/page"`}},
+		{"missing property", 200, `{"data": {"version": "1.0.0"}}`, "getRelease", []string{`property "meta" is missing`}},
+		{"undocumented status", 404, `{}`, "getRelease", []string{"status is not supported, response code 404"}},
+		{"unknown operation", 200, `{}`, "listReleases", []string{`Error loading validate_against_openapi: no operation "listReleases"`}},
+	} {
+		diags := validateOpenAPI(context.Background(), specFile, tc.operationID, response(tc.status), []byte(tc.body))
+		if len(tc.want) == 0 {
+			if diags.HasError() {
+				t.Errorf("%s: unexpected diagnostics %v", tc.name, diags)
+			}
+			continue
+		}
+		if len(diags) != len(tc.want) {
+			t.Errorf("%s: got %d diagnostics %v; want %d", tc.name, len(diags), diags, len(tc.want))
+			continue
+		}
+		for i, want := range tc.want {
+			if got := diags[i].Summary + " " + diags[i].Detail; !strings.Contains(got, want) {
+				t.Errorf("%s: diagnostic %q; want %q", tc.name, got, want)
+			}
+		}
+	}
+}
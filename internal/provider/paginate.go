@@ -0,0 +1,243 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxPages = 10
+
+// paginator follows the next links of a paginate block
+type paginator struct {
+	client *http.Client
+	// the headers of the first request are sent to every page on its host,
+	// except those only valid for the first request
+	header            http.Header
+	nextHeader        string
+	nextJSONPath      string
+	maxPages          int
+	disableDecompress bool
+	responseCharset   string
+	// signs each page with a request_nonce of its own, nil without one
+	setNonce func(*http.Request) error
+	// not sent to a page on another host than the first request
+	stripHeaders []string
+}
+
+// follow returns the bodies of every page, starting with firstBody of the
+// response to firstURL, and whether max_pages stopped it before the last one
+func (p *paginator) follow(ctx context.Context, firstURL *neturl.URL, first *http.Response, firstBody []byte) (pages []string, truncated bool, err error) {
+	current, resp, body := firstURL, first, firstBody
+	pages = []string{string(firstBody)}
+	visited := map[string]bool{firstURL.String(): true}
+	for {
+		next, err := p.nextURL(current, resp, body)
+		if err != nil {
+			return nil, false, fmt.Errorf("page %d: %s", len(pages), err)
+		}
+		// a loop would otherwise only end with max_pages
+		if next == nil || visited[next.String()] {
+			return pages, false, nil
+		}
+		if len(pages) >= p.maxPages {
+			return pages, true, nil
+		}
+		visited[next.String()] = true
+
+		if resp, body, err = p.get(ctx, firstURL, next); err != nil {
+			return nil, false, fmt.Errorf("page %d: %s", len(pages)+1, err)
+		}
+		pages = append(pages, string(body))
+		current = next
+	}
+}
+
+func (p *paginator) get(ctx context.Context, firstURL, pageURL *neturl.URL) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header = p.header.Clone()
+	// each page is a request of its own, not a retry of the first
+	req.Header.Del("Idempotency-Key")
+	if p.setNonce != nil {
+		if err := p.setNonce(req); err != nil {
+			return nil, nil, fmt.Errorf("setting request_nonce headers: %s", err)
+		}
+	}
+	// as for redirects, credentials stay on the host of url
+	if !strings.EqualFold(pageURL.Hostname(), firstURL.Hostname()) {
+		for _, name := range p.stripHeaders {
+			req.Header.Del(name)
+		}
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer drainBody(resp.Body)
+
+	var body []byte
+	if p.disableDecompress {
+		body, err = ioutil.ReadAll(resp.Body)
+	} else if r, decodeErr := decodeContentEncoding(resp); decodeErr != nil {
+		err = decodeErr
+	} else {
+		body, err = ioutil.ReadAll(r)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("GET %s: response code %d, response body: %s", pageURL.Redacted(), resp.StatusCode, string(body))
+	}
+
+	charset := p.responseCharset
+	if charset == "" {
+		if decoded, ok := decodeBOM(body); ok {
+			return resp, decoded, nil
+		}
+		if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+			charset = params["charset"]
+		}
+	}
+	if decoded, err := decodeCharset(body, charset); err == nil {
+		body = decoded
+	}
+	return resp, body, nil
+}
+
+// nextURL is the link to the page after the one at current, nil on the last
+func (p *paginator) nextURL(current *neturl.URL, resp *http.Response, body []byte) (*neturl.URL, error) {
+	var next string
+	if p.nextHeader != "" {
+		values := resp.Header.Values(p.nextHeader)
+		if http.CanonicalHeaderKey(p.nextHeader) == "Link" {
+			next = linkNext(values)
+		} else if len(values) > 0 {
+			next = strings.TrimSpace(values[0])
+		}
+	} else {
+		var err error
+		if next, err = jsonPathString(body, p.nextJSONPath); err != nil {
+			return nil, err
+		}
+	}
+	if next == "" {
+		return nil, nil
+	}
+
+	u, err := current.Parse(next)
+	if err != nil {
+		return nil, fmt.Errorf("invalid next page URL %q: %s", next, err)
+	}
+	return u, nil
+}
+
+var linkRelNext = regexp.MustCompile(`(?i)^rel="?([^"]*)"?$`)
+
+// linkNext returns the target of the rel="next" link of RFC 8288 Link header
+// values, eg <https://api.example.com/items?page=2>; rel="next"
+func linkNext(values []string) string {
+	for _, value := range values {
+		for _, link := range strings.Split(value, ",") {
+			params := strings.Split(link, ";")
+			target := strings.TrimSpace(params[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range params[1:] {
+				m := linkRelNext.FindStringSubmatch(strings.TrimSpace(param))
+				if m == nil {
+					continue
+				}
+				for _, rel := range strings.Fields(m[1]) {
+					if strings.EqualFold(rel, "next") {
+						return strings.Trim(target, "<>")
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// jsonPathString looks up a JSONPath of names and indexes, eg
+// $.links.next or $.data[0].cursor, in the JSON body. A missing or null
+// value is empty.
+func jsonPathString(body []byte, path string) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "", fmt.Errorf("response body is not JSON: %s", err)
+	}
+
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return "", err
+	}
+	for _, step := range steps {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[step]
+		case []interface{}:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", nil
+			}
+			value = v[i]
+		default:
+			return "", nil
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("%s is not a string", path)
+	}
+}
+
+var jsonPathStep = regexp.MustCompile(`^(?:\.([^.\[\]]+)|\[(\d+)\]|\['([^']*)'\])`)
+
+func parseJSONPath(path string) ([]string, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if rest == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, "[") {
+		rest = "." + rest
+	}
+	var steps []string
+	for rest != "" {
+		m := jsonPathStep.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("unsupported JSONPath %q, only names and indexes such as $.links.next or $.data[0].cursor are", path)
+		}
+		steps = append(steps, m[1]+m[2]+m[3])
+		rest = rest[len(m[0]):]
+	}
+	return steps, nil
+}
+
+func validateJSONPath(val interface{}, key string) (warns []string, errs []error) {
+	if v, ok := val.(string); ok {
+		if _, err := parseJSONPath(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", key, err))
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("error parsing %s", key))
+	}
+	return
+}
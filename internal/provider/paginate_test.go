@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"testing"
+)
+
+func TestLinkNext(t *testing.T) {
+	for _, tc := range []struct {
+		values []string
+		want   string
+	}{
+		{[]string{`<https://api.example.com/items?page=2>; rel="next"`}, "https://api.example.com/items?page=2"},
+		{[]string{`</items?page=1>; rel="prev", </items?page=3>; rel=next`}, "/items?page=3"},
+		{[]string{`</items?page=1>; rel="first"`, `</items?page=9>; title="x"; rel="last next"`}, "/items?page=9"},
+		{[]string{`</items?page=1>; rel="prev"`}, ""},
+		{nil, ""},
+	} {
+		if got := linkNext(tc.values); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.values, got, tc.want)
+		}
+	}
+}
+
+func TestJSONPathString(t *testing.T) {
+	body := []byte(`{"links":{"next":"/items?page=2","prev":null},"data":[{"cursor":"abc"}],"count":2}`)
+	for path, want := range map[string]string{
+		"$.links.next":     "/items?page=2",
+		"links.next":       "/items?page=2",
+		"$['links'].next":  "/items?page=2",
+		"$.links.prev":     "",
+		"$.links.missing":  "",
+		"$.data[0].cursor": "abc",
+		"$.data[1].cursor": "",
+		"$.count.next":     "",
+	} {
+		got, err := jsonPathString(body, path)
+		if err != nil {
+			t.Errorf("%s: err: %s", path, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", path, got, want)
+		}
+	}
+
+	if _, err := jsonPathString(body, "$.count"); err == nil {
+		t.Error("expected an error for a number")
+	}
+	if _, errs := validateJSONPath("$.data[*].cursor", "next_jsonpath"); len(errs) == 0 {
+		t.Error("expected a wildcard to be rejected")
+	}
+}
+
+func TestPaginatorPageHeaders(t *testing.T) {
+	var pageHeader http.Header
+	var pageURI string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pageHeader, pageURI = r.Header.Clone(), r.URL.RequestURI()
+		w.Write([]byte("page 2"))
+	}))
+	defer server.Close()
+
+	settings := map[string]interface{}{
+		"timestamp_header": "X-Timestamp",
+		"nonce_header":     "X-Nonce",
+		"signature_header": "X-Signature",
+	}
+	sign := localHMACSigner("secret")
+	first, _ := http.NewRequest(http.MethodPost, server.URL+"/items", nil)
+	first.Header.Set("Idempotency-Key", "key-1")
+	first.Header.Set("X-Custom", "kept")
+	if err := setNonceHeaders(context.Background(), first, settings, "body", sign); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &paginator{
+		client:     server.Client(),
+		header:     first.Header,
+		nextHeader: "Link",
+		maxPages:   2,
+		setNonce: func(req *http.Request) error {
+			return setNonceHeaders(context.Background(), req, settings, "", sign)
+		},
+	}
+	firstURL, _ := neturl.Parse(server.URL + "/items")
+	resp := &http.Response{Header: http.Header{"Link": {`</items?page=2>; rel="next"`}}}
+	if _, _, err := p.follow(context.Background(), firstURL, resp, []byte("page 1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if pageHeader.Get("X-Custom") != "kept" {
+		t.Errorf("X-Custom is %q; want the header of the first request", pageHeader.Get("X-Custom"))
+	}
+	if pageHeader.Get("Idempotency-Key") != "" {
+		t.Errorf("Idempotency-Key of the first request was sent to the page")
+	}
+	if pageHeader.Get("X-Nonce") == first.Header.Get("X-Nonce") {
+		t.Errorf("X-Nonce of the first request was replayed")
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(pageHeader.Get("X-Timestamp") + "\n" + pageHeader.Get("X-Nonce") + "\nGET\n" + pageURI + "\n"))
+	if want := hex.EncodeToString(mac.Sum(nil)); pageHeader.Get("X-Signature") != want {
+		t.Errorf("X-Signature is %q; want %q, signed for the page", pageHeader.Get("X-Signature"), want)
+	}
+}
+
+func TestPaginatorOtherHostHeaders(t *testing.T) {
+	var pageHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pageHeader = r.Header.Clone()
+		w.Write([]byte("page 2"))
+	}))
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer foo")
+	header.Set("X-Tenant", "qux")
+	header.Set("X-Nonce", "nonce-1")
+	header.Set("X-Other", "kept")
+	p := &paginator{
+		client:       server.Client(),
+		header:       header,
+		nextHeader:   "Link",
+		maxPages:     2,
+		stripHeaders: []string{"Authorization", "X-Nonce", "X-Tenant"},
+	}
+	// localhost rather than 127.0.0.1 so the page is on another host
+	next := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/items?page=2"
+	firstURL, _ := neturl.Parse(server.URL + "/items")
+	resp := &http.Response{Header: http.Header{"Link": {"<" + next + `>; rel="next"`}}}
+	if _, _, err := p.follow(context.Background(), firstURL, resp, []byte("page 1")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range p.stripHeaders {
+		if pageHeader.Get(name) != "" {
+			t.Errorf("%s was sent to the page on another host", name)
+		}
+	}
+	if pageHeader.Get("X-Other") != "kept" {
+		t.Errorf("X-Other is %q; want the header of the first request", pageHeader.Get("X-Other"))
+	}
+}
@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// parseBody parses body according to its Content-Type (JSON, XML or form
+// encoded) and returns the result JSON encoded. Other types are not parsed
+// and return the body as is.
+func parseBody(contentType string, body []byte) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	var parsed interface{}
+	var err error
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		err = json.Unmarshal(body, &parsed)
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		parsed, err = parseXML(body)
+	case mediaType == "application/x-www-form-urlencoded":
+		parsed, err = parseForm(body)
+	default:
+		return string(body), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("response body is not valid %s: %s", mediaType, err)
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(parsed); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// unwrapJSON returns the JSON of the value of key in the JSON object body
+func unwrapJSON(body []byte, key string) ([]byte, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("response body is not a JSON object: %s", err)
+	}
+	value, ok := envelope[key]
+	if !ok {
+		return nil, fmt.Errorf("response body has no %q key", key)
+	}
+	return value, nil
+}
+
+func parseForm(body []byte) (map[string]interface{}, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	form := map[string]interface{}{}
+	for name, v := range values {
+		form[name] = singleOrList(v)
+	}
+	return form, nil
+}
+
+// parseXML maps the document to {root name: element}. An element with
+// neither attributes nor child elements is its text; any other is a map of
+// "@" prefixed attributes, child elements by name (a list when repeated) and
+// "#text" for its non blank text. Namespaces are dropped.
+func parseXML(body []byte) (map[string]interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no root element")
+		} else if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			root, err := parseXMLElement(decoder, start)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{start.Name.Local: root}, nil
+		}
+	}
+}
+
+func parseXMLElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	element := map[string]interface{}{}
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		element["@"+attr.Name.Local] = attr.Value
+	}
+
+	children := map[string][]interface{}{}
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := parseXMLElement(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			children[t.Name.Local] = append(children[t.Name.Local], child)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if len(element) == 0 && len(children) == 0 {
+				return content, nil
+			}
+			for name, values := range children {
+				element[name] = singleOrListOf(values)
+			}
+			if content != "" {
+				element["#text"] = content
+			}
+			return element, nil
+		}
+	}
+}
+
+func singleOrList(values []string) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+func singleOrListOf(values []interface{}) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
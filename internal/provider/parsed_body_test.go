@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestParseBody(t *testing.T) {
+	for _, tc := range []struct {
+		contentType string
+		body        string
+		want        string
+	}{
+		{"application/json; charset=utf-8", `{"b": [1, 2], "a": "x"}`, `{"a":"x","b":[1,2]}`},
+		{"application/vnd.api+json", `[true]`, `[true]`},
+		{"text/xml", `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom" lang="en"><title>t</title><entry id="1">a</entry><entry id="2"><link href="/2"/></entry></feed>`,
+			`{"feed":{"@lang":"en","entry":[{"#text":"a","@id":"1"},{"@id":"2","link":{"@href":"/2"}}],"title":"t"}}`},
+		{"application/x-www-form-urlencoded", `a=1&b=2&b=3`, `{"a":"1","b":["2","3"]}`},
+		{"text/plain", `1.0.0`, `1.0.0`},
+		{"", `<p>`, `<p>`},
+	} {
+		got, err := parseBody(tc.contentType, []byte(tc.body))
+		if err != nil {
+			t.Errorf("%s: err: %s", tc.contentType, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.contentType, got, tc.want)
+		}
+	}
+
+	for _, contentType := range []string{"application/json", "application/xml"} {
+		if _, err := parseBody(contentType, []byte(`{"a":`)); err == nil {
+			t.Errorf("%s: expected an error", contentType)
+		}
+	}
+}
+
+func TestUnwrapJSON(t *testing.T) {
+	got, err := unwrapJSON([]byte(`{"data": {"id": 1, "tags": ["a"]}, "meta": {"page": 1}}`), "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"id": 1, "tags": ["a"]}` {
+		t.Errorf("got %s", got)
+	}
+
+	for _, body := range []string{`{"meta": {}}`, `[{"data": 1}]`, `data`} {
+		if _, err := unwrapJSON([]byte(body), "data"); err == nil {
+			t.Errorf("%s: expected an error", body)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+//go:build cgo
+// +build cgo
+
+package provider
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"sync"
+
+	"github.com/ThalesIgnite/crypto11"
+)
+
+// pkcs11Contexts stay open for the life of the provider process: the signer is
+// used by pooled transports on every new connection, after the read that
+// loaded it has returned.
+var (
+	pkcs11Mu       sync.Mutex
+	pkcs11Contexts = map[string]*crypto11.Context{}
+)
+
+// validatePKCS11Module accepts any path, the module is only loaded on read
+func validatePKCS11Module(val interface{}, key string) (warns []string, errs []error) {
+	if _, ok := val.(string); !ok {
+		errs = append(errs, fmt.Errorf("error parsing %s", key))
+	}
+	return
+}
+
+// pkcs11Certificate pairs the PEM certificate chain with a private key held in
+// a PKCS#11 token, which never leaves it
+func pkcs11Certificate(certPEM []byte, settings map[string]interface{}) (tls.Certificate, error) {
+	cert, leaf, err := parseCertificateChain(certPEM)
+	if err != nil {
+		return cert, err
+	}
+
+	ctx, err := pkcs11Context(settings)
+	if err != nil {
+		return cert, err
+	}
+
+	var id, label []byte
+	if keyID := settings["key_id"].(string); keyID != "" {
+		if id, err = hex.DecodeString(keyID); err != nil {
+			return cert, fmt.Errorf("key_id must be hex encoded: %s", err)
+		}
+	}
+	if keyLabel := settings["key_label"].(string); keyLabel != "" {
+		label = []byte(keyLabel)
+	}
+	if id == nil && label == nil {
+		return cert, fmt.Errorf("one of key_id or key_label must be set")
+	}
+
+	signer, err := ctx.FindKeyPair(id, label)
+	if err != nil {
+		return cert, err
+	}
+	if signer == nil {
+		return cert, fmt.Errorf("no key pair found in the token for key_id %q key_label %q", settings["key_id"], settings["key_label"])
+	}
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(leaf.PublicKey) {
+		return cert, fmt.Errorf("private key does not match the public key of client_crt")
+	}
+
+	cert.PrivateKey = signer
+	return cert, nil
+}
+
+func pkcs11Context(settings map[string]interface{}) (*crypto11.Context, error) {
+	config := &crypto11.Config{
+		Path:       settings["module"].(string),
+		TokenLabel: settings["token_label"].(string),
+		Pin:        settings["pin"].(string),
+	}
+	if slot := settings["slot_number"].(int); slot >= 0 {
+		config.SlotNumber = &slot
+	}
+	id := fmt.Sprintf("%s|%s|%v", config.Path, config.TokenLabel, settings["slot_number"])
+
+	pkcs11Mu.Lock()
+	defer pkcs11Mu.Unlock()
+	if ctx, ok := pkcs11Contexts[id]; ok {
+		return ctx, nil
+	}
+	ctx, err := crypto11.Configure(config)
+	if err != nil {
+		return nil, err
+	}
+	pkcs11Contexts[id] = ctx
+	return ctx, nil
+}
+
+// parseCertificateChain returns a tls.Certificate holding the chain, without
+// its private key, and the parsed leaf
+func parseCertificateChain(certPEM []byte) (tls.Certificate, *x509.Certificate, error) {
+	var cert tls.Certificate
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		return cert, nil, fmt.Errorf("no certificate found in client_crt")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return cert, nil, err
+	}
+	return cert, leaf, nil
+}
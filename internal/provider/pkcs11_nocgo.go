@@ -0,0 +1,23 @@
+//go:build !cgo
+// +build !cgo
+
+package provider
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// pkcs11Unsupported is reported at plan time, and at read time should the
+// validation have been skipped
+const pkcs11Unsupported = "this build of the provider does not support PKCS#11, it was built without cgo (CGO_ENABLED=1 is required)"
+
+// validatePKCS11Module rejects client_key_pkcs11 when plan validates the config
+func validatePKCS11Module(val interface{}, key string) (warns []string, errs []error) {
+	return nil, []error{fmt.Errorf("client_key_pkcs11: %s", pkcs11Unsupported)}
+}
+
+// PKCS#11 modules are C libraries, loading one requires cgo
+func pkcs11Certificate(certPEM []byte, settings map[string]interface{}) (tls.Certificate, error) {
+	return tls.Certificate{}, fmt.Errorf(pkcs11Unsupported)
+}
@@ -0,0 +1,16 @@
+//go:build !cgo
+// +build !cgo
+
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePKCS11ModuleWithoutCgo(t *testing.T) {
+	_, errs := validatePKCS11Module("/usr/lib/softhsm/libsofthsm2.so", "module")
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "built without cgo") {
+		t.Errorf("errs = %v; want the built without cgo error", errs)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build cgo
+// +build cgo
+
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCertificateChain(t *testing.T) {
+	cert, leaf, err := parseCertificateChain([]byte(strings.ReplaceAll(clientCert+"\n"+caCert, `\n`, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Certificate) != 2 {
+		t.Errorf("got %d certificates, want 2", len(cert.Certificate))
+	}
+	if leaf.Subject.CommonName != "user@domain.com" {
+		t.Errorf("leaf is %s, want user@domain.com", leaf.Subject.CommonName)
+	}
+
+	if _, _, err := parseCertificateChain([]byte(strings.ReplaceAll(clientKey, `\n`, "\n"))); err == nil {
+		t.Error("expected an error without a certificate")
+	}
+}
+
+func TestPKCS11CertificateMissingModule(t *testing.T) {
+	_, err := pkcs11Certificate([]byte(strings.ReplaceAll(clientCert, `\n`, "\n")), map[string]interface{}{
+		"module":      "/nonexistent/libpkcs11.so",
+		"token_label": "token",
+		"slot_number": -1,
+		"pin":         "1234",
+		"key_label":   "key",
+		"key_id":      "",
+	})
+	if err == nil {
+		t.Error("expected an error loading a missing module")
+	}
+}
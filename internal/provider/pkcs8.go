@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/youmark/pkcs8"
+)
+
+// x509KeyPair is tls.X509KeyPair also accepting a PKCS#8 key encrypted with
+// password, a PEM "ENCRYPTED PRIVATE KEY" block
+func x509KeyPair(certPEM, keyPEM []byte, password string) (tls.Certificate, error) {
+	rest := keyPEM
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			// not encrypted, or no key at all which tls.X509KeyPair reports
+			if password != "" {
+				return tls.Certificate{}, fmt.Errorf("client_key_password is set but the key is not an ENCRYPTED PRIVATE KEY")
+			}
+			return tls.X509KeyPair(certPEM, keyPEM)
+		}
+		if block.Type != "ENCRYPTED PRIVATE KEY" {
+			continue
+		}
+
+		if password == "" {
+			return tls.Certificate{}, fmt.Errorf("the key is encrypted, set client_key_password")
+		}
+		key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("decrypting the key: %s", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		return tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	}
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/youmark/pkcs8"
+)
+
+// encryptPKCS8 returns keyPEM, with literal \n as the test constants, as an
+// ENCRYPTED PRIVATE KEY block
+func encryptPKCS8(t *testing.T, keyPEM string, password string) []byte {
+	t.Helper()
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(keyPEM, `\n`, "\n")))
+	if block == nil {
+		t.Fatal("no PEM key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	der, err := pkcs8.MarshalPrivateKey(key, []byte(password), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der})
+}
+
+func TestX509KeyPair(t *testing.T) {
+	certPEM := []byte(strings.ReplaceAll(clientCert, `\n`, "\n"))
+	keyPEM := []byte(strings.ReplaceAll(clientKey, `\n`, "\n"))
+	encrypted := encryptPKCS8(t, clientKey, "s3cret")
+
+	for _, tc := range []struct {
+		name     string
+		key      []byte
+		password string
+		wantErr  string
+	}{
+		{"encrypted", encrypted, "s3cret", ""},
+		{"plain", keyPEM, "", ""},
+		{"wrong password", encrypted, "wrong", "decrypting the key"},
+		{"no password", encrypted, "", "set client_key_password"},
+		{"password of a plain key", keyPEM, "s3cret", "not an ENCRYPTED PRIVATE KEY"},
+	} {
+		cert, err := x509KeyPair(certPEM, tc.key, tc.password)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: err = %v; want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: err: %s", tc.name, err)
+			continue
+		}
+		if cert.PrivateKey == nil {
+			t.Errorf("%s: no private key", tc.name)
+		}
+	}
+}
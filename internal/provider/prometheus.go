@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// promSample is a single sample from the Prometheus text exposition format
+type promSample struct {
+	labels map[string]string
+	value  string
+}
+
+// parsePrometheusMetric returns every sample of the metric called name found in
+// body, which is in the Prometheus text exposition format.
+// See https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+func parsePrometheusMetric(body []byte, name string) ([]promSample, error) {
+	var samples []promSample
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		end := strings.IndexAny(line, "{ \t")
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: missing value", lineNo)
+		}
+		if line[:end] != name {
+			continue
+		}
+		rest := line[end:]
+
+		labels := map[string]string{}
+		if strings.HasPrefix(rest, "{") {
+			var err error
+			if labels, rest, err = parsePrometheusLabels(rest[1:]); err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNo, err)
+			}
+		}
+
+		// the value may be followed by an optional timestamp
+		fields := strings.Fields(rest)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected a value and optional timestamp, got %q", lineNo, rest)
+		}
+		samples = append(samples, promSample{labels: labels, value: fields[0]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// parsePrometheusLabels parses `name="value",...}` and returns the labels and
+// whatever follows the closing brace
+func parsePrometheusLabels(s string) (map[string]string, string, error) {
+	labels := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+
+		eq := strings.Index(s, "=")
+		if eq < 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return nil, "", fmt.Errorf("malformed label in %q", s)
+		}
+		label := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			if c == '"' {
+				s = s[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return nil, "", fmt.Errorf("unterminated value for label %q", label)
+		}
+		labels[label] = value.String()
+
+		s = strings.TrimLeft(s, " \t")
+		s = strings.TrimPrefix(s, ",")
+	}
+}
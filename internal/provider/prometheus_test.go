@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testPrometheusMetrics = `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# Escaping in label values:
+msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\""} 1.458255915e9
+
+# Minimalistic line:
+metric_without_timestamp_and_labels 12.47
+`
+
+func TestParsePrometheusMetric(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want []promSample
+	}{
+		{
+			name: "http_requests_total",
+			want: []promSample{
+				{labels: map[string]string{"method": "post", "code": "200"}, value: "1027"},
+				{labels: map[string]string{"method": "post", "code": "400"}, value: "3"},
+			},
+		},
+		{
+			name: "msdos_file_access_time_seconds",
+			want: []promSample{
+				{labels: map[string]string{"path": `C:\DIR\FILE.TXT`, "error": "Cannot find file:\n\"FILE.TXT\""}, value: "1.458255915e9"},
+			},
+		},
+		{
+			name: "metric_without_timestamp_and_labels",
+			want: []promSample{
+				{labels: map[string]string{}, value: "12.47"},
+			},
+		},
+		{
+			name: "http_requests",
+			want: nil,
+		},
+	} {
+		got, err := parsePrometheusMetric([]byte(testPrometheusMetrics), tc.name)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v; want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParsePrometheusMetric_malformed(t *testing.T) {
+	if _, err := parsePrometheusMetric([]byte(`foo{bar="baz} 1`), "foo"); err == nil {
+		t.Errorf("expected an error for an unterminated label value")
+	}
+}
@@ -1,15 +1,169 @@
 package provider
 
 import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"golang.org/x/time/rate"
 )
 
+// providerConfig is the provider meta passed to every data source read
+type providerConfig struct {
+	// client certificates to present, keyed by lowercased target hostname
+	clientCertificates map[string]tls.Certificate
+	// nil unless client_crt is set, for hosts without a client_certificate
+	defaultClientCertificate *tls.Certificate
+	// default for data sources that do not set insecure_skip_verify
+	insecureSkipVerify bool
+	// nil unless dns_cache_ttl_seconds is set
+	dnsCache *dnsCache
+	// larger response bodies are written to body_file, 0 for no limit
+	maxInlineBodyBytes int
+	// transports shared by data sources with the same TLS and proxy settings
+	transports *transportPool
+	// in flight requests of data sources with coalesce_requests
+	requests *requestCoalescer
+	// nil unless requests_per_second is set
+	rateLimiter *rate.Limiter
+}
+
 func New() *schema.Provider {
 	return &schema.Provider{
-		Schema: map[string]*schema.Schema{},
+		Schema: map[string]*schema.Schema{
+			"insecure_skip_verify": {
+				Description: "Default `insecure_skip_verify` for every data source. Can also be set with the `HTTP_FULL_INSECURE_SKIP_VERIFY` environment variable.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("HTTP_FULL_INSECURE_SKIP_VERIFY", false),
+			},
+			"dns_cache_ttl_seconds": {
+				Description: "Cache hostname resolutions for this many seconds across all data sources. Disabled when 0.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     0,
+			},
+			"max_inline_body_bytes": {
+				Description: "Response bodies larger than this are written to a temporary `body_file` instead of `response_body`. Disabled when 0.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     0,
+			},
+			"max_idle_conns_per_host": {
+				Description: "Maximum number of idle connections kept open to each host, shared by every data source with the same TLS and proxy settings.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     http.DefaultMaxIdleConnsPerHost,
+			},
+			"requests_per_second": {
+				Description: "Maximum rate of requests sent by all data sources together, retries, redirects and pages included. Data sources setting `bypass_rate_limit` are not limited. Disabled when 0.",
+				Type:        schema.TypeFloat,
+				Optional:    true,
+				Default:     0,
+			},
+			"client_crt": {
+				Description:  "Default client certificate (PEM) for mTLS, presented by data sources that neither set their own nor match a `client_certificate` host.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				RequiredWith: []string{"client_key"},
+			},
+			"client_key": {
+				Description:  "Default client certificate (PEM) private key.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Sensitive:    true,
+				RequiredWith: []string{"client_crt"},
+			},
+			"client_certificate": {
+				Description: "Client certificate to present for mTLS to a given host, unless the data source sets its own.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"host": {
+							Description: "Hostname of the target server the certificate is presented to.",
+							Type:        schema.TypeString,
+							Required:    true,
+						},
+						"client_crt": {
+							Description: "Client Certificate (PEM).",
+							Type:        schema.TypeString,
+							Required:    true,
+						},
+						"client_key": {
+							Description: "Client Certificate (PEM) private Key.",
+							Type:        schema.TypeString,
+							Required:    true,
+							Sensitive:   true,
+						},
+					},
+				},
+			},
+		},
+		ConfigureContextFunc: providerConfigure,
 		DataSourcesMap: map[string]*schema.Resource{
-			"http": dataSource(),
+			"http":            dataSource(),
+			"http_tcp_check":  dataSourceTCPCheck(),
+			"http_jwt_decode": dataSourceJWTDecode(),
 		},
 		ResourcesMap: map[string]*schema.Resource{},
 	}
 }
+
+func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+	config := &providerConfig{
+		clientCertificates: map[string]tls.Certificate{},
+		insecureSkipVerify: d.Get("insecure_skip_verify").(bool),
+		maxInlineBodyBytes: d.Get("max_inline_body_bytes").(int),
+	}
+
+	maxIdleConnsPerHost := d.Get("max_idle_conns_per_host").(int)
+	if maxIdleConnsPerHost < 0 {
+		return nil, diag.Errorf("max_idle_conns_per_host must not be negative")
+	}
+	config.transports = newTransportPool(maxIdleConnsPerHost)
+	config.requests = &requestCoalescer{}
+
+	ttl := d.Get("dns_cache_ttl_seconds").(int)
+	if ttl < 0 {
+		return nil, diag.Errorf("dns_cache_ttl_seconds must not be negative")
+	}
+	if ttl > 0 {
+		config.dnsCache = newDNSCache(time.Duration(ttl) * time.Second)
+	}
+
+	rps := d.Get("requests_per_second").(float64)
+	if rps < 0 {
+		return nil, diag.Errorf("requests_per_second must not be negative")
+	}
+	if rps > 0 {
+		config.rateLimiter = rate.NewLimiter(rate.Limit(rps), 1)
+	}
+
+	if crt, ok := d.GetOk("client_crt"); ok {
+		cert, err := tls.X509KeyPair([]byte(crt.(string)), []byte(d.Get("client_key").(string)))
+		if err != nil {
+			return nil, diag.Errorf("Error loading client_crt and client_key: %s", err)
+		}
+		config.defaultClientCertificate = &cert
+	}
+
+	for _, c := range d.Get("client_certificate").([]interface{}) {
+		cc := c.(map[string]interface{})
+		host := strings.ToLower(cc["host"].(string))
+		if _, ok := config.clientCertificates[host]; ok {
+			return nil, diag.Errorf("Duplicate client_certificate for host %s", host)
+		}
+		cert, err := tls.X509KeyPair([]byte(cc["client_crt"].(string)), []byte(cc["client_key"].(string)))
+		if err != nil {
+			return nil, diag.Errorf("Error loading client_certificate for host %s: %s", host, err)
+		}
+		config.clientCertificates[host] = cert
+	}
+
+	return config, nil
+}
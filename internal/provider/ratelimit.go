@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitedClient returns a copy of c waiting for limiter before every
+// request it sends, so a pooled client can be throttled without throttling
+// the reads that bypass the limit
+func rateLimitedClient(c *http.Client, limiter *rate.Limiter) *http.Client {
+	limited := *c
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	limited.Transport = &rateLimitedTransport{base: transport, limiter: limiter}
+	return &limited
+}
+
+// rateLimitedTransport is called for every attempt, redirect and page
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	limiter *rate.Limiter
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// gives up once the wait would outlast the deadline of req
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitedClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	limiter := rate.NewLimiter(rate.Every(100*time.Millisecond), 1)
+	get := func(client *http.Client, ctx context.Context) error {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		drainBody(resp.Body)
+		return nil
+	}
+
+	limited := rateLimitedClient(server.Client(), limiter)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := get(limited, context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("3 limited requests took %s; want at least 200ms", elapsed)
+	}
+
+	// the pooled client does not wait
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		if err := get(server.Client(), context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("3 requests bypassing the limit took %s; want no wait", elapsed)
+	}
+
+	// once the token is used up, a wait longer than the deadline fails right away
+	limiter.SetLimit(rate.Every(time.Hour))
+	limiter.Allow()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start = time.Now()
+	if err := get(limited, ctx); err == nil {
+		t.Error("want an error when the limit cannot be met before the deadline")
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("request past the deadline took %s; want an immediate error", elapsed)
+	}
+}
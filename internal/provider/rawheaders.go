@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+)
+
+// recordingConn records the response head, status line and headers as sent
+// by the server, once armed for a request. The transport reads TLS and HTTP/2
+// connections on top of it, so only plain HTTP/1.x heads can be recorded.
+type recordingConn struct {
+	net.Conn
+
+	mu        sync.Mutex
+	recording bool
+	head      []byte
+	// whether the client certificate was presented in the TLS handshake on top
+	clientCertSent bool
+}
+
+// recordingDialer wraps every connection dialed by dial in a recordingConn
+func recordingDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &recordingConn{Conn: conn}, nil
+	}
+}
+
+// record starts recording the head of the next response
+func (c *recordingConn) record() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recording = true
+	c.head = nil
+}
+
+// recorded returns the head of the last response, without the blank line
+// ending it
+func (c *recordingConn) recorded() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.recording {
+		return ""
+	}
+	return string(c.head)
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.recording && n > 0 {
+		c.head = append(c.head, p[:n]...)
+		for {
+			end := bytes.Index(c.head, []byte("\r\n\r\n"))
+			if end < 0 {
+				break
+			}
+			// skip informational responses such as 100 Continue
+			if isInformationalHead(c.head[:end]) {
+				c.head = c.head[end+4:]
+				continue
+			}
+			// anything after is the body
+			c.head = c.head[:end]
+			c.recording = false
+			break
+		}
+	}
+	return n, err
+}
+
+func isInformationalHead(head []byte) bool {
+	// eg HTTP/1.1 100 Continue
+	fields := bytes.Fields(head)
+	return len(fields) > 1 && len(fields[1]) == 3 && fields[1][0] == '1'
+}
@@ -0,0 +1,34 @@
+package provider
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestRecordingConn(t *testing.T) {
+	client, server := net.Pipe()
+	conn := &recordingConn{Conn: client}
+	conn.record()
+
+	go func() {
+		// in small writes so the head spans several reads
+		for _, chunk := range []string{
+			"HTTP/1.1 100 Continue\r\n\r\n",
+			"HTTP/1.1 200 OK\r\nx-lower: a\r\n",
+			"X-Double: 2\r\nX-Double: 1\r\n\r\nbody",
+		} {
+			server.Write([]byte(chunk))
+		}
+		server.Close()
+	}()
+
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	want := "HTTP/1.1 200 OK\r\nx-lower: a\r\nX-Double: 2\r\nX-Double: 1"
+	if got := conn.recorded(); got != want {
+		t.Errorf("recorded %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+const defaultKrb5Conf = "/etc/krb5.conf"
+
+// setSPNEGOHeader obtains a Kerberos service ticket using the settings of the
+// spnego block and sets the `Authorization: Negotiate` header on req
+func setSPNEGOHeader(req *http.Request, settings map[string]interface{}) error {
+	krb5Conf := settings["krb5_conf"].(string)
+	if krb5Conf == "" {
+		krb5Conf = defaultKrb5Conf
+	}
+	keytabFile := settings["keytab_file"].(string)
+	ccacheFile := settings["ccache_file"].(string)
+
+	if (keytabFile == "") == (ccacheFile == "") {
+		return fmt.Errorf("exactly one of keytab_file or ccache_file must be set")
+	}
+
+	cfg, err := config.Load(krb5Conf)
+	if err != nil {
+		return fmt.Errorf("error loading %s: %s", krb5Conf, err)
+	}
+
+	var cl *client.Client
+	if keytabFile != "" {
+		username := settings["username"].(string)
+		realm := settings["realm"].(string)
+		if username == "" || realm == "" {
+			return fmt.Errorf("username and realm must be set with keytab_file")
+		}
+		kt, err := keytab.Load(keytabFile)
+		if err != nil {
+			return fmt.Errorf("error loading keytab_file: %s", err)
+		}
+		cl = client.NewWithKeytab(username, realm, kt, cfg, client.DisablePAFXFAST(true))
+		if err := cl.Login(); err != nil {
+			return fmt.Errorf("error logging in as %s@%s: %s", username, realm, err)
+		}
+	} else {
+		cc, err := credentials.LoadCCache(ccacheFile)
+		if err != nil {
+			return fmt.Errorf("error loading ccache_file: %s", err)
+		}
+		if cl, err = client.NewFromCCache(cc, cfg, client.DisablePAFXFAST(true)); err != nil {
+			return fmt.Errorf("error loading credentials from ccache_file: %s", err)
+		}
+	}
+	defer cl.Destroy()
+
+	// an empty spn defaults to HTTP/<hostname of the request>
+	return spnego.SetSPNEGOHeader(cl, req, settings["spn"].(string))
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestSetSPNEGOHeader_invalid(t *testing.T) {
+	krb5Conf := filepath.Join(t.TempDir(), "krb5.conf")
+	if err := os.WriteFile(krb5Conf, []byte("[libdefaults]\n  default_realm = EXAMPLE.COM\n"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, tc := range []struct {
+		settings map[string]interface{}
+		want     string
+	}{
+		{
+			settings: map[string]interface{}{},
+			want:     "exactly one of keytab_file or ccache_file must be set",
+		},
+		{
+			settings: map[string]interface{}{"keytab_file": "a", "ccache_file": "b"},
+			want:     "exactly one of keytab_file or ccache_file must be set",
+		},
+		{
+			settings: map[string]interface{}{"keytab_file": "a", "krb5_conf": "/does/not/exist"},
+			want:     "error loading /does/not/exist",
+		},
+		{
+			settings: map[string]interface{}{"keytab_file": "a", "krb5_conf": krb5Conf},
+			want:     "username and realm must be set with keytab_file",
+		},
+		{
+			settings: map[string]interface{}{"ccache_file": "/does/not/exist", "krb5_conf": krb5Conf},
+			want:     "error loading ccache_file",
+		},
+	} {
+		settings := map[string]interface{}{
+			"keytab_file": "",
+			"username":    "",
+			"realm":       "",
+			"ccache_file": "",
+			"krb5_conf":   "",
+			"spn":         "",
+		}
+		for k, v := range tc.settings {
+			settings[k] = v
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+		err := setSPNEGOHeader(req, settings)
+		if err == nil || !regexp.MustCompile(regexp.QuoteMeta(tc.want)).MatchString(err.Error()) {
+			t.Errorf("setSPNEGOHeader(%v) = %v; want %q", tc.settings, err, tc.want)
+		}
+		if req.Header.Get("Authorization") != "" {
+			t.Errorf("Authorization header set on error")
+		}
+	}
+}
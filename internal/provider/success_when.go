@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+)
+
+// compileSuccessWhen compiles a success_when CEL expression, which can use
+// `status` (int), `headers` (map of string to string) and `body` (string)
+func compileSuccessWhen(expr string) (cel.Program, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("status", cel.IntType),
+		cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("body", cel.StringType),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if !cel.BoolType.IsAssignableType(ast.OutputType()) {
+		return nil, fmt.Errorf("expression must evaluate to a bool, got %s", ast.OutputType())
+	}
+
+	return env.Program(ast)
+}
+
+// evalSuccessWhen reports whether the response satisfies the success_when expression
+func evalSuccessWhen(expr string, status int, headers map[string]string, body string) (bool, error) {
+	prg, err := compileSuccessWhen(expr)
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := prg.Eval(map[string]interface{}{
+		"status":  status,
+		"headers": headers,
+		"body":    body,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	ok, isBool := out.Value().(bool)
+	if !isBool {
+		return false, fmt.Errorf("expression must evaluate to a bool, got %v", out.Value())
+	}
+	return ok, nil
+}
+
+func validateSuccessWhen(val interface{}, key string) (warns []string, errs []error) {
+	if v, ok := val.(string); ok {
+		if _, err := compileSuccessWhen(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s is not a valid CEL expression: %s", key, err))
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("error parsing %s", key))
+	}
+	return
+}
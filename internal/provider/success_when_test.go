@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestEvalSuccessWhen(t *testing.T) {
+	headers := map[string]string{"Content-Type": "application/json"}
+
+	for _, tc := range []struct {
+		expr   string
+		status int
+		want   bool
+	}{
+		{`status == 200`, 200, true},
+		{`status == 200`, 404, false},
+		{`status in [200, 404] && body.contains("ready")`, 404, true},
+		{`headers["Content-Type"] == "application/json" && body.startsWith("{")`, 200, true},
+		{`"X-Missing" in headers`, 200, false},
+	} {
+		got, err := evalSuccessWhen(tc.expr, tc.status, headers, `{"state":"ready"}`)
+		if err != nil {
+			t.Errorf("%s: err: %s", tc.expr, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s with status %d = %v; want %v", tc.expr, tc.status, got, tc.want)
+		}
+	}
+}
+
+func TestValidateSuccessWhen(t *testing.T) {
+	for _, expr := range []string{
+		`status ==`,
+		`status + 1`,
+		`unknown == 1`,
+	} {
+		if _, errs := validateSuccessWhen(expr, "success_when"); len(errs) == 0 {
+			t.Errorf("%s: expected a validation error", expr)
+		}
+	}
+
+	if _, errs := validateSuccessWhen(`status < 500`, "success_when"); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const defaultTCPCheckTimeoutMs = 5000
+
+// dataSourceTCPCheck only opens a TCP connection, to check that a port is
+// reachable before making HTTP requests to it
+func dataSourceTCPCheck() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceTCPCheckRead,
+
+		Schema: map[string]*schema.Schema{
+			"host": {
+				Description: "Hostname or IP address to connect to.",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"port": {
+				Description: "TCP port to connect to.",
+				Type:        schema.TypeInt,
+				Required:    true,
+			},
+			"timeout_ms": {
+				Description: "Time in ms to wait for the connection, including the hostname lookup.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     defaultTCPCheckTimeoutMs,
+			},
+			"interface": {
+				Description: "Name of the network interface (eg `eth1`) whose address the connection is made from.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"open": {
+				Description: "Whether the connection was established.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"connect_ms": {
+				Description: "Time spent establishing the connection, in milliseconds.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"remote_addr": {
+				Description: "The address (`ip:port`) connected to.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"error": {
+				Description: "Why the connection failed, empty when `open`.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceTCPCheckRead(ctx context.Context, d *schema.ResourceData, meta interface{}) (diags diag.Diagnostics) {
+	port := d.Get("port").(int)
+	if port < 1 || port > 65535 {
+		return append(diags, diag.Errorf("port must be between 1 and 65535, got %d", port)...)
+	}
+	timeout := d.Get("timeout_ms").(int)
+	if timeout <= 0 {
+		return append(diags, diag.Errorf("timeout_ms must be positive, got %d", timeout)...)
+	}
+	addr := net.JoinHostPort(d.Get("host").(string), strconv.Itoa(port))
+
+	dialer := &net.Dialer{}
+	if name := d.Get("interface").(string); name != "" {
+		localIP, err := interfaceAddr(name)
+		if err != nil {
+			return append(diags, diag.Errorf("Error resolving interface: %s", err)...)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: localIP}
+	}
+	dial := dialer.DialContext
+	if config, ok := meta.(*providerConfig); ok && config.dnsCache != nil {
+		dial = config.dnsCache.dialContext(dialer)
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := dial(dialCtx, "tcp", addr)
+	connectTime := time.Since(start)
+
+	// a closed port is the answer of the check, not an error
+	var remoteAddr, dialError string
+	if err != nil {
+		dialError = err.Error()
+		connectTime = 0
+	} else {
+		remoteAddr = conn.RemoteAddr().String()
+		conn.Close()
+	}
+
+	if err := d.Set("open", dialError == ""); err != nil {
+		return append(diags, diag.Errorf("Error setting open: %s", err)...)
+	}
+	if err := d.Set("connect_ms", connectTime.Milliseconds()); err != nil {
+		return append(diags, diag.Errorf("Error setting connect_ms: %s", err)...)
+	}
+	if err := d.Set("remote_addr", remoteAddr); err != nil {
+		return append(diags, diag.Errorf("Error setting remote_addr: %s", err)...)
+	}
+	if err := d.Set("error", dialError); err != nil {
+		return append(diags, diag.Errorf("Error setting error: %s", err)...)
+	}
+
+	d.SetId(addr)
+
+	return diags
+}
@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+const testDataSourceConfig_tcp_check = `
+data "http_tcp_check" "open" {
+  host = "127.0.0.1"
+  port = %d
+}
+
+data "http_tcp_check" "closed" {
+  host       = "127.0.0.1"
+  port       = %d
+  timeout_ms = 1000
+}
+
+output "open" {
+  value = "${data.http_tcp_check.open.open},${data.http_tcp_check.closed.open}"
+}
+
+output "remote_addr" {
+  value = data.http_tcp_check.open.remote_addr
+}
+
+output "closed_error" {
+  value = data.http_tcp_check.closed.error
+}
+`
+
+func TestDataSource_tcp_check(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	openPort := listener.Addr().(*net.TCPAddr).Port
+
+	// a port nothing listens on anymore
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testDataSourceConfig_tcp_check, openPort, closedPort),
+				Check: func(s *terraform.State) error {
+					outputs := s.RootModule().Outputs
+
+					if outputs["open"].Value != "true,false" {
+						return fmt.Errorf(
+							`'open' output is %s; want 'true,false'`,
+							outputs["open"].Value,
+						)
+					}
+
+					if outputs["remote_addr"].Value != listener.Addr().String() {
+						return fmt.Errorf(
+							`'remote_addr' output is %s; want '%s'`,
+							outputs["remote_addr"].Value,
+							listener.Addr().String(),
+						)
+					}
+
+					if !regexp.MustCompile("connection refused").MatchString(outputs["closed_error"].Value.(string)) {
+						return fmt.Errorf(
+							`'closed_error' output is %s; want 'connection refused'`,
+							outputs["closed_error"].Value,
+						)
+					}
+
+					return nil
+				},
+			},
+		},
+	})
+}
+
+const testDataSourceConfig_tcp_check_port = `
+data "http_tcp_check" "http_test" {
+  host = "127.0.0.1"
+  port = 70000
+}
+`
+
+func TestDataSource_tcp_check_port(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      testDataSourceConfig_tcp_check_port,
+				ExpectError: regexp.MustCompile("port must be between 1 and 65535, got 70000"),
+			},
+		},
+	})
+}
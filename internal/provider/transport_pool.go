@@ -0,0 +1,226 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transportKey holds every setting a transport is built from. Reads with the
+// same key share a transport, and so its idle connections.
+type transportKey struct {
+	insecureSkipVerify    bool
+	disableSessionTickets bool
+	serverName            string
+	// SHA-256 of the ca and ca_dir certificates
+	rootCAs            string
+	minValidityDays    int
+	serverFingerprints string
+	expectedCertCN     string
+	expectedCertSAN    string
+	// SHA-256 of the pinned_issuer certificate
+	pinnedIssuer string
+	nextProtos   string
+	forceHTTP2   bool
+	clientHello  string
+	// SHA-256 of the client certificate chain, files rotated on disk get a new transport
+	clientCert             string
+	disableCompression     bool
+	maxResponseHeaderBytes int
+	proxyConnectHeaders    string
+	// proxy_url and no_proxy_hosts
+	proxy      string
+	keyLogFile string
+	// address of the interface connections are made from
+	localIP string
+}
+
+// clientPoolKey adds the settings of the client itself to those of its transport
+type clientPoolKey struct {
+	transport            transportKey
+	timeout              time.Duration
+	restrictRedirectHost bool
+	httpsOnlyRedirects   bool
+	maxRedirects         int
+	resendBodyOnRedirect bool
+	// comma separated canonical names, from redirectStripHeaders
+	redirectStripHeaders string
+}
+
+// transportPool keeps the clients and transports of one provider instance for
+// its lifetime
+type transportPool struct {
+	maxIdleConnsPerHost int
+
+	mu         sync.Mutex
+	clients    map[clientPoolKey]*http.Client
+	transports map[transportKey]*http.Transport
+	signers    map[kmsSignerKey]macSigner
+}
+
+func newTransportPool(maxIdleConnsPerHost int) *transportPool {
+	return &transportPool{
+		maxIdleConnsPerHost: maxIdleConnsPerHost,
+		clients:             map[clientPoolKey]*http.Client{},
+		transports:          map[transportKey]*http.Transport{},
+		signers:             map[kmsSignerKey]macSigner{},
+	}
+}
+
+// client returns the client for key, the first time calling newClient with the
+// transport for key.transport, itself built by newTransport if missing. A nil
+// pool does no pooling and always builds a new client and transport.
+func (p *transportPool) client(key clientPoolKey, newTransport func() *http.Transport, newClient func(*http.Transport) *http.Client) *http.Client {
+	if p == nil {
+		return newClient(newTransport())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.clients[key]; ok {
+		return c
+	}
+	tr, ok := p.transports[key.transport]
+	if !ok {
+		tr = newTransport()
+		tr.MaxIdleConnsPerHost = p.maxIdleConnsPerHost
+		p.transports[key.transport] = tr
+	}
+	c := newClient(tr)
+	p.clients[key] = c
+	return c
+}
+
+// signer returns the KMS signer for key, built by newSigner the first time. A
+// nil pool always builds a new one.
+func (p *transportPool) signer(key kmsSignerKey, newSigner func() (macSigner, error)) (macSigner, error) {
+	if p == nil {
+		return newSigner()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if sign, ok := p.signers[key]; ok {
+		return sign, nil
+	}
+	sign, err := newSigner()
+	if err != nil {
+		return nil, err
+	}
+	p.signers[key] = sign
+	return sign, nil
+}
+
+// connClientCertSent records, for a new connection, whether the client
+// certificate was presented during its handshake and reports it for reused
+// ones. It is kept on the recordingConn under the TLS of conn, and so goes
+// away with the connection.
+func connClientCertSent(conn net.Conn, reused bool, handshakeSent bool) bool {
+	for {
+		if raw, ok := conn.(*recordingConn); ok {
+			raw.mu.Lock()
+			defer raw.mu.Unlock()
+			if !reused {
+				raw.clientCertSent = handshakeSent
+			}
+			return raw.clientCertSent
+		}
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			// not dialed by recordingDialer
+			return handshakeSent
+		}
+		conn = wrapper.NetConn()
+	}
+}
+
+type clientCertStateKey struct{}
+
+// clientCertState is passed in the request context to the shared
+// GetClientCertificate, which runs in the handshake of a new connection
+type clientCertState struct {
+	mu   sync.Mutex
+	sent bool
+}
+
+func (s *clientCertState) wasSent() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent
+}
+
+func withClientCertState(ctx context.Context, state *clientCertState) context.Context {
+	return context.WithValue(ctx, clientCertStateKey{}, state)
+}
+
+// markClientCertSent records in the clientCertState of ctx, if any, that the
+// client certificate was presented
+func markClientCertSent(ctx context.Context) {
+	if state, ok := ctx.Value(clientCertStateKey{}).(*clientCertState); ok {
+		state.mu.Lock()
+		state.sent = true
+		state.mu.Unlock()
+	}
+}
+
+// getClientCertificate presents the certificate certFor selects for the host
+// being dialed, like the default selection sending no certificate rather than
+// one the server will not accept
+func getClientCertificate(certFor func(host string) *tls.Certificate) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		host, _ := cri.Context().Value(clientCertHostKey{}).(string)
+		cert := certFor(host)
+		if cert == nil || cri.SupportsCertificate(cert) != nil {
+			return &tls.Certificate{}, nil
+		}
+		markClientCertSent(cri.Context())
+		return cert, nil
+	}
+}
+
+// staticClientCertificate presents cert to every host
+func staticClientCertificate(cert tls.Certificate) func(host string) *tls.Certificate {
+	return func(string) *tls.Certificate {
+		return &cert
+	}
+}
+
+// hostClientCertificate presents the certificate of the host in certs, or
+// defaultCert, which may be nil, to hosts without one
+func hostClientCertificate(certs map[string]tls.Certificate, defaultCert *tls.Certificate) func(host string) *tls.Certificate {
+	return func(host string) *tls.Certificate {
+		if cert, ok := certs[strings.ToLower(host)]; ok {
+			return &cert
+		}
+		return defaultCert
+	}
+}
+
+type clientCertHostKey struct{}
+
+// clientCertHostClient returns a copy of c passing the host of every request,
+// redirects and pages included, to the GetClientCertificate of the handshake
+// of a new connection
+func clientCertHostClient(c *http.Client) *http.Client {
+	withHost := *c
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	withHost.Transport = &clientCertHostTransport{base: transport}
+	return &withHost
+}
+
+// clientCertHostTransport is called for every attempt, redirect and page
+type clientCertHostTransport struct {
+	base http.RoundTripper
+}
+
+func (t *clientCertHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := context.WithValue(req.Context(), clientCertHostKey{}, req.URL.Hostname())
+	return t.base.RoundTrip(req.WithContext(ctx))
+}
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransportPoolClient(t *testing.T) {
+	pool := newTransportPool(4)
+	transports := 0
+	newTransport := func() *http.Transport {
+		transports++
+		return &http.Transport{}
+	}
+	newClient := func(tr *http.Transport) *http.Client {
+		return &http.Client{Transport: tr}
+	}
+
+	a := pool.client(clientPoolKey{transport: transportKey{serverName: "a"}}, newTransport, newClient)
+	if pool.client(clientPoolKey{transport: transportKey{serverName: "a"}}, newTransport, newClient) != a {
+		t.Error("same key returned a different client")
+	}
+	b := pool.client(clientPoolKey{transport: transportKey{serverName: "a"}, timeout: time.Second}, newTransport, newClient)
+	if b == a || b.Transport != a.Transport {
+		t.Error("different client settings should return a different client sharing the transport")
+	}
+	if pool.client(clientPoolKey{transport: transportKey{serverName: "b"}}, newTransport, newClient).Transport == a.Transport {
+		t.Error("different transport key returned the same transport")
+	}
+	if transports != 2 {
+		t.Errorf("built %d transports; want 2", transports)
+	}
+	if a.Transport.(*http.Transport).MaxIdleConnsPerHost != 4 {
+		t.Errorf("MaxIdleConnsPerHost is %d; want 4", a.Transport.(*http.Transport).MaxIdleConnsPerHost)
+	}
+
+	var unpooled *transportPool
+	if unpooled.client(clientPoolKey{}, newTransport, newClient) == unpooled.client(clientPoolKey{}, newTransport, newClient) {
+		t.Error("nil pool returned the same client")
+	}
+}
+
+func TestConnClientCertSent(t *testing.T) {
+	pipe, _ := net.Pipe()
+	withCert := &recordingConn{Conn: pipe}
+	withoutCert := &recordingConn{Conn: pipe}
+
+	if !connClientCertSent(withCert, false, true) {
+		t.Error("new connection: want true")
+	}
+	if connClientCertSent(withoutCert, false, false) {
+		t.Error("new connection: want false")
+	}
+	// no handshake happens on reuse, the TLS is on top of the dialed connection
+	if !connClientCertSent(tls.Client(withCert, &tls.Config{}), true, false) {
+		t.Error("reused connection: want true")
+	}
+	if connClientCertSent(tls.Client(withoutCert, &tls.Config{}), true, false) {
+		t.Error("reused connection: want false")
+	}
+	// not dialed by recordingDialer
+	if !connClientCertSent(pipe, true, true) {
+		t.Error("other connection: want the handshake")
+	}
+}
+
+func TestGetClientCertificateByHost(t *testing.T) {
+	cert, err := tls.X509KeyPair([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newServer := func(handler http.HandlerFunc) *httptest.Server {
+		server := httptest.NewUnstartedServer(handler)
+		server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+		server.StartTLS()
+		return server
+	}
+	sentCert := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, len(r.TLS.PeerCertificates) > 0)
+	}
+	other := newServer(sentCert)
+	defer other.Close()
+	server := newServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			// same listener, another host name
+			http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+			return
+		}
+		sentCert(w, r)
+	})
+	defer server.Close()
+
+	client := clientCertHostClient(&http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify:   true,
+				GetClientCertificate: getClientCertificate(hostClientCertificate(map[string]tls.Certificate{"127.0.0.1": cert}, nil)),
+			},
+		},
+	})
+	for _, tc := range []struct {
+		url  string
+		want string
+	}{
+		{server.URL + "/get", "true"},
+		{server.URL + "/redirect", "false"},
+	} {
+		resp, err := client.Get(tc.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tc.want {
+			t.Errorf("%s: certificate sent is %s; want %s", tc.url, body, tc.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// clientHelloPresets are the ClientHello fingerprints tls_client_hello can
+// mimic, the latest version of each client known to utls
+var clientHelloPresets = map[string]utls.ClientHelloID{
+	"chrome":  utls.HelloChrome_Auto,
+	"firefox": utls.HelloFirefox_Auto,
+	"safari":  utls.HelloSafari_Auto,
+	"edge":    utls.HelloEdge_Auto,
+	"ios":     utls.HelloIOS_Auto,
+	"android": utls.HelloAndroid_11_OkHttp,
+}
+
+func validateClientHello(val interface{}, key string) (warns []string, errs []error) {
+	if v, ok := val.(string); ok {
+		if _, ok := clientHelloPresets[v]; !ok {
+			var names []string
+			for name := range clientHelloPresets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			errs = append(errs, fmt.Errorf("%s must be one of %s, got %q", key, strings.Join(names, ", "), v))
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("error parsing %s", key))
+	}
+	return
+}
+
+// clientHelloDialer returns a DialTLSContext for http.Transport sending the
+// ClientHello of preset over connections of dial, with the server
+// verification of config and the client certificate certFor selects for the
+// host dialed, if not nil
+func clientHelloDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error), config *tls.Config, certFor func(host string) *tls.Certificate, preset string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	// kept with the pooled transport, as the ClientSessionCache of the Go TLS
+	var sessions utls.ClientSessionCache
+	if !config.SessionTicketsDisabled {
+		sessions = utls.NewLRUClientSessionCache(0)
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		uconfig := &utls.Config{
+			ServerName:             config.ServerName,
+			RootCAs:                config.RootCAs,
+			InsecureSkipVerify:     config.InsecureSkipVerify,
+			KeyLogWriter:           config.KeyLogWriter,
+			SessionTicketsDisabled: config.SessionTicketsDisabled,
+			ClientSessionCache:     sessions,
+			// no pre_shared_key extension is sent without a session to resume
+			OmitEmptyPsk: true,
+			// rather than a panic for a TLS 1.2 session and a preset without session_ticket
+			PreferSkipResumptionOnNilExtension: true,
+		}
+		if uconfig.ServerName == "" {
+			uconfig.ServerName = host
+		}
+		if certFor != nil {
+			// as getClientCertificate, for the host dialed
+			uconfig.GetClientCertificate = func(cri *utls.CertificateRequestInfo) (*utls.Certificate, error) {
+				cert := certFor(host)
+				if cert == nil {
+					return &utls.Certificate{}, nil
+				}
+				ucert := &utls.Certificate{
+					Certificate: cert.Certificate,
+					PrivateKey:  cert.PrivateKey,
+					Leaf:        cert.Leaf,
+				}
+				if cri.SupportsCertificate(ucert) != nil {
+					return &utls.Certificate{}, nil
+				}
+				markClientCertSent(cri.Context())
+				return ucert, nil
+			}
+		}
+		if verify := config.VerifyConnection; verify != nil {
+			uconfig.VerifyConnection = func(cs utls.ConnectionState) error {
+				return verify(tlsConnectionState(cs))
+			}
+		}
+
+		spec, err := utls.UTLSIdToSpec(clientHelloPresets[preset])
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// the transport only speaks HTTP/2 over a *tls.Conn, at the cost of a different JA4
+		for _, ext := range spec.Extensions {
+			if alpn, ok := ext.(*utls.ALPNExtension); ok {
+				alpn.AlpnProtocols = []string{"http/1.1"}
+			}
+		}
+		if sessions != nil {
+			hasPSK := false
+			for _, ext := range spec.Extensions {
+				if _, ok := ext.(utls.PreSharedKeyExtension); ok {
+					hasPSK = true
+				}
+			}
+			// as the browser does once it holds a session ticket; the extension is
+			// left out of the ClientHello until then, and must be the last one
+			if !hasPSK {
+				spec.Extensions = append(spec.Extensions, &utls.UtlsPreSharedKeyExtension{})
+			}
+		}
+		uconn := utls.UClient(conn, uconfig, utls.HelloCustom)
+		if err := uconn.ApplyPreset(&spec); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := uconn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return uconn, nil
+	}
+}
+
+// clientHelloState is the TLS state of a connection made by
+// clientHelloDialer, which the transport cannot set in Response.TLS, nil for
+// any other connection
+func clientHelloState(conn net.Conn) *tls.ConnectionState {
+	uconn, ok := conn.(*utls.UConn)
+	if !ok {
+		return nil
+	}
+	state := tlsConnectionState(uconn.ConnectionState())
+	return &state
+}
+
+func tlsConnectionState(cs utls.ConnectionState) tls.ConnectionState {
+	return tls.ConnectionState{
+		Version:                     cs.Version,
+		HandshakeComplete:           cs.HandshakeComplete,
+		DidResume:                   cs.DidResume,
+		CipherSuite:                 cs.CipherSuite,
+		NegotiatedProtocol:          cs.NegotiatedProtocol,
+		ServerName:                  cs.ServerName,
+		PeerCertificates:            cs.PeerCertificates,
+		VerifiedChains:              cs.VerifiedChains,
+		SignedCertificateTimestamps: cs.SignedCertificateTimestamps,
+		OCSPResponse:                cs.OCSPResponse,
+	}
+}
@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClientHelloDialer(t *testing.T) {
+	var mu sync.Mutex
+	var greased bool
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("1.0.0"))
+	}))
+	server.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			// GREASE values, eg 0x1a1a, are only sent by browsers
+			greased = false
+			for _, suite := range hello.CipherSuites {
+				if suite&0x0f0f == 0x0a0a {
+					greased = true
+				}
+			}
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	get := func(config *tls.Config, preset string) (string, *tls.ConnectionState, error) {
+		tr := &http.Transport{
+			DialTLSContext: clientHelloDialer((&net.Dialer{}).DialContext, config, nil, preset),
+		}
+		defer tr.CloseIdleConnections()
+		var state *tls.ConnectionState
+		// as dataSourceRead, which the transport leaves Response.TLS nil to
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				state = clientHelloState(info.Conn)
+			},
+		}
+		req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, server.URL, nil)
+		resp, err := (&http.Client{Transport: tr}).Do(req)
+		if err != nil {
+			return "", nil, err
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body), state, nil
+	}
+
+	for preset := range clientHelloPresets {
+		body, state, err := get(&tls.Config{RootCAs: roots}, preset)
+		if err != nil {
+			t.Errorf("%s: err: %s", preset, err)
+			continue
+		}
+		if body != "1.0.0" {
+			t.Errorf("%s: body = %q; want %q", preset, body, "1.0.0")
+		}
+		if state == nil || len(state.PeerCertificates) == 0 || !state.PeerCertificates[0].Equal(server.Certificate()) {
+			t.Errorf("%s: the TLS state should have the server certificate", preset)
+		}
+	}
+
+	if _, _, err := get(&tls.Config{RootCAs: roots}, "chrome"); err != nil {
+		t.Fatal(err)
+	}
+	if !greased {
+		t.Error("the chrome ClientHello should have GREASE cipher suites")
+	}
+
+	// certificate checks such as allowed_server_fingerprints still apply
+	rejected := errors.New("rejected")
+	_, _, err := get(&tls.Config{RootCAs: roots, VerifyConnection: func(tls.ConnectionState) error { return rejected }}, "firefox")
+	if err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("err = %v; want the VerifyConnection error", err)
+	}
+	if _, _, err := get(&tls.Config{}, "firefox"); err == nil {
+		t.Error("a server certificate from an unknown authority should be rejected")
+	}
+
+	if _, errs := validateClientHello("netscape", "tls_client_hello"); len(errs) == 0 {
+		t.Error("an unknown preset should not validate")
+	}
+}
+
+func TestClientHelloDialerSessions(t *testing.T) {
+	cert, err := tls.X509KeyPair([]byte(localhostCert), []byte(localhostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every response closes its connection, so each request does a handshake
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "close")
+		fmt.Fprintf(w, "%t,%t", len(r.TLS.PeerCertificates) > 0, r.TLS.DidResume)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	for _, tc := range []struct {
+		disable bool
+		want    []string
+	}{
+		{false, []string{"true,false", "true,true"}},
+		{true, []string{"true,false", "true,false"}},
+	} {
+		for preset := range clientHelloPresets {
+			if preset == "android" {
+				// no psk_key_exchange_modes, a TLS 1.3 session cannot be resumed
+				continue
+			}
+			config := &tls.Config{InsecureSkipVerify: true, SessionTicketsDisabled: tc.disable}
+			tr := &http.Transport{
+				DialTLSContext: clientHelloDialer(recordingDialer((&net.Dialer{}).DialContext), config, staticClientCertificate(cert), preset),
+			}
+			for i, want := range tc.want {
+				certState := &clientCertState{}
+				var sent bool
+				// as dataSourceRead
+				trace := &httptrace.ClientTrace{
+					GotConn: func(info httptrace.GotConnInfo) {
+						sent = connClientCertSent(info.Conn, info.Reused, certState.wasSent())
+					},
+				}
+				ctx := withClientCertState(httptrace.WithClientTrace(context.Background(), trace), certState)
+				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+				resp, err := (&http.Client{Transport: tr}).Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if string(body) != want {
+					t.Errorf("%s SessionTicketsDisabled %t, request %d: certificate,resumed is %s; want %s", preset, tc.disable, i+1, body, want)
+				}
+				// a resumed session does not present the certificate again
+				if wantSent := !strings.HasSuffix(want, "true"); sent != wantSent {
+					t.Errorf("%s SessionTicketsDisabled %t, request %d: client_cert_sent is %t; want %t", preset, tc.disable, i+1, sent, wantSent)
+				}
+			}
+			tr.CloseIdleConnections()
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const defaultVaultAddr = "https://127.0.0.1:8200"
+
+// vaultSecretSchema is a block referencing a field of a Vault KV secret
+func vaultSecretSchema(description string, conflictsWith ...string) *schema.Schema {
+	return &schema.Schema{
+		Description:   description,
+		Type:          schema.TypeList,
+		Optional:      true,
+		MaxItems:      1,
+		ConflictsWith: conflictsWith,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"path": {
+					Description: "API path of the secret, eg `secret/data/myapp` for a KV version 2 mount.",
+					Type:        schema.TypeString,
+					Required:    true,
+				},
+				"field": {
+					Description: "Field of the secret holding the value.",
+					Type:        schema.TypeString,
+					Required:    true,
+				},
+			},
+		},
+	}
+}
+
+// readVaultSecret reads the field of the KV (version 1 or 2) secret referenced
+// by settings from the Vault server in VAULT_ADDR. It authenticates with
+// VAULT_TOKEN or the token helper file ~/.vault-token; without either the
+// request is sent as-is, as expected by a Vault Agent using its auto-auth token.
+func readVaultSecret(ctx context.Context, settings map[string]interface{}) (string, error) {
+	path := strings.Trim(settings["path"].(string), "/")
+	field := settings["field"].(string)
+
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		addr = defaultVaultAddr
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := vaultToken()
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	client, err := vaultClient()
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reading %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("reading %s: %s", path, err)
+	}
+
+	data := secret.Data
+	// KV version 2 nests the secret and adds its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s has no string field %q", path, field)
+	}
+	return value, nil
+}
+
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil
+	}
+	b, err := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// vaultClient trusts VAULT_CACERT in addition to the system roots
+func vaultClient() (*http.Client, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if caCert := os.Getenv("VAULT_CACERT"); caCert != "" {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading VAULT_CACERT: %s", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in VAULT_CACERT %s", caCert)
+		}
+		tr.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{Transport: tr, Timeout: 30 * time.Second}, nil
+}
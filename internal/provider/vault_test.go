@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadVaultSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.test" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			w.Write([]byte(`{"data":{"data":{"token":"v2-token"},"metadata":{"version":3}}}`))
+		case "/v1/kv/app":
+			w.Write([]byte(`{"data":{"token":"v1-token"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "s.test")
+
+	for path, want := range map[string]string{
+		"secret/data/app": "v2-token",
+		"/kv/app":         "v1-token",
+	} {
+		got, err := readVaultSecret(context.Background(), map[string]interface{}{"path": path, "field": "token"})
+		if err != nil {
+			t.Errorf("%s: err: %s", path, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s = %q; want %q", path, got, want)
+		}
+	}
+
+	for _, settings := range []map[string]interface{}{
+		{"path": "secret/data/app", "field": "missing"},
+		{"path": "secret/data/other", "field": "token"},
+	} {
+		if _, err := readVaultSecret(context.Background(), settings); err == nil {
+			t.Errorf("%v: expected an error", settings)
+		}
+	}
+
+	t.Setenv("VAULT_TOKEN", "s.wrong")
+	if _, err := readVaultSecret(context.Background(), map[string]interface{}{"path": "secret/data/app", "field": "token"}); err == nil {
+		t.Error("expected permission denied")
+	}
+}